@@ -2,6 +2,9 @@ package dotenv
 
 import (
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -252,6 +255,81 @@ func TestEnvSetUnset(t *testing.T) {
 	}
 }
 
+func TestApply(t *testing.T) {
+	// t.Setenv restores the previous state, including unset keys
+	t.Setenv("APPLY_EXISTING", "platform")
+	t.Setenv("APPLY_EMPTY", "")
+	t.Setenv("APPLY_NEW", "")
+	os.Unsetenv("APPLY_NEW")
+
+	env := map[string]string{
+		"APPLY_EXISTING": "file",
+		"APPLY_EMPTY":    "file",
+		"APPLY_NEW":      "file",
+	}
+
+	report, err := Apply(env)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if os.Getenv("APPLY_EXISTING") != "platform" || os.Getenv("APPLY_EMPTY") != "" || os.Getenv("APPLY_NEW") != "file" {
+		t.Errorf("Expected existing keys to be kept, got %q, %q, %q",
+			os.Getenv("APPLY_EXISTING"), os.Getenv("APPLY_EMPTY"), os.Getenv("APPLY_NEW"))
+	}
+	if !slices.Equal(report.Set, []string{"APPLY_NEW"}) ||
+		!slices.Equal(report.Skipped, []string{"APPLY_EMPTY", "APPLY_EXISTING"}) || report.Overwritten != nil {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	env["APPLY_NEW"] = "override"
+	report, err = Overload(env)
+	if err != nil {
+		t.Fatalf("Overload failed: %v", err)
+	}
+	for key, value := range env {
+		if os.Getenv(key) != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, os.Getenv(key))
+		}
+	}
+	if report.Set != nil || report.Skipped != nil ||
+		!slices.Equal(report.Overwritten, []string{"APPLY_EMPTY", "APPLY_EXISTING", "APPLY_NEW"}) {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+func TestApplyRestore(t *testing.T) {
+	t.Setenv("RESTORE_EXISTING", "platform")
+	t.Setenv("RESTORE_NEW", "")
+	os.Unsetenv("RESTORE_NEW")
+
+	report, err := Overload(map[string]string{"RESTORE_EXISTING": "file", "RESTORE_NEW": "file"})
+	if err != nil {
+		t.Fatalf("Overload failed: %v", err)
+	}
+	if os.Getenv("RESTORE_EXISTING") != "file" || os.Getenv("RESTORE_NEW") != "file" {
+		t.Fatal("Expected variables to be applied")
+	}
+
+	if err := report.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if os.Getenv("RESTORE_EXISTING") != "platform" {
+		t.Errorf("Expected previous value to be restored, got %q", os.Getenv("RESTORE_EXISTING"))
+	}
+	if HasEnv("RESTORE_NEW") {
+		t.Error("Expected new variable to be unset")
+	}
+
+	// A failure, here on the last key in sorted order, leaves the environment untouched
+	_, err = Overload(map[string]string{"RESTORE_EXISTING": "file", "RESTORE_NEW": "file", "RESTORE_ZZ\x00": "bad"})
+	if err == nil {
+		t.Fatal("Expected error for an invalid key")
+	}
+	if os.Getenv("RESTORE_EXISTING") != "platform" || HasEnv("RESTORE_NEW") {
+		t.Errorf("Expected changes to be rolled back, got %q, %v", os.Getenv("RESTORE_EXISTING"), HasEnv("RESTORE_NEW"))
+	}
+}
+
 func TestEnvErrorHandling(t *testing.T) {
 	// Test invalid int
 	os.Setenv("INVALID_INT", "not_a_number")
@@ -458,6 +536,7 @@ func TestWriteEnvFile(t *testing.T) {
 		"MULTILINE_KEY":   "line1\nline2\ttab",
 		"EMPTY_KEY":       "",
 		"SPECIAL_CHARS":   "!@#$%^&*()_+-={}[]|\\:;\"'<>,.?/",
+		"DOLLAR_KEY":      "literal $SIMPLE_KEY and ${SIMPLE_KEY}",
 	}
 
 	filename := "test_write.env"
@@ -490,6 +569,105 @@ func TestWriteEnvFile(t *testing.T) {
 	if loadedEnv["MULTILINE_KEY"] != "line1\nline2\ttab" {
 		t.Errorf("MULTILINE_KEY mismatch: expected 'line1\\nline2\\ttab', got '%s'", loadedEnv["MULTILINE_KEY"])
 	}
+
+	if loadedEnv["DOLLAR_KEY"] != env["DOLLAR_KEY"] {
+		t.Errorf("DOLLAR_KEY mismatch: expected %q, got %q", env["DOLLAR_KEY"], loadedEnv["DOLLAR_KEY"])
+	}
+}
+
+func TestWriteEnvFileSystemd(t *testing.T) {
+	env := map[string]string{
+		"SIMPLE_KEY":    "simple_value",
+		"MULTILINE_KEY": "line1\nline2\ttab",
+		"SPECIAL_CHARS": "!@#$%^&*()_+-={}[]|\\:;\"'<>,.?/`",
+		"DOLLAR_KEY":    "literal $SIMPLE_KEY and ${SIMPLE_KEY}",
+		"ESCAPES":       `C:\path\n "quoted"`,
+	}
+
+	filename := "test_write_systemd.env"
+	defer os.Remove(filename)
+
+	if err := WriteEnvFileWithOptions(filename, env, Options{Dialect: DialectSystemd}); err != nil {
+		t.Fatalf("WriteEnvFileWithOptions failed: %v", err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file must read back the same with systemd's rules and ours
+	for _, dialect := range []Dialect{DialectSystemd, DialectDefault} {
+		loaded, err := NewParserWithOptions(string(data), Options{Dialect: dialect}).Parse()
+		if err != nil {
+			t.Fatalf("dialect %d: failed to parse written file: %v", dialect, err)
+		}
+		for key, value := range env {
+			if loaded[key] != value {
+				t.Errorf("dialect %d: %s mismatch: expected %q, got %q", dialect, key, value, loaded[key])
+			}
+		}
+	}
+}
+
+func TestWriteEnvFileCommentRule(t *testing.T) {
+	env := map[string]string{
+		"URL":     "https://host/page#anchor",
+		"COLOR":   "#ff0000",
+		"SPACED":  "value # not a comment",
+		"TRAILER": "ends with #",
+	}
+
+	dir := t.TempDir()
+	for _, opts := range []Options{{}, {CommentNeedsSpace: true}, {Dialect: DialectCompose}} {
+		filename := filepath.Join(dir, "comments.env")
+		if err := WriteEnvFileWithOptions(filename, env, opts); err != nil {
+			t.Fatalf("WriteEnvFileWithOptions failed: %v", err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// '#' alone only needs quotes when it always starts a comment
+		commentNeedsSpace := opts.CommentNeedsSpace || opts.Dialect == DialectCompose
+		if quoted := !strings.Contains(string(data), "COLOR=#ff0000\n"); quoted == commentNeedsSpace {
+			t.Errorf("%+v: unexpected quoting of COLOR in %q", opts, data)
+		}
+
+		loaded, err := NewParserWithOptions(string(data), opts).Parse()
+		if err != nil {
+			t.Fatalf("%+v: failed to parse written file: %v", opts, err)
+		}
+		for key, value := range env {
+			if loaded[key] != value {
+				t.Errorf("%+v: %s mismatch: expected %q, got %q", opts, key, value, loaded[key])
+			}
+		}
+	}
+}
+
+func TestWriteEnvFileMultilineOptions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "multiline.env")
+	opts := Options{Heredocs: true, Backticks: true}
+	env := map[string]string{
+		"HEREDOC":  "<<EOF",
+		"STRIPPED": "<<-END",
+		"TICKED":   "`cmd`",
+		"INNER":    "a`b<<c",
+	}
+
+	if err := WriteEnvFileWithOptions(filename, env, opts); err != nil {
+		t.Fatalf("WriteEnvFileWithOptions failed: %v", err)
+	}
+	loaded, err := LoadWithOptions(filename, opts)
+	if err != nil {
+		t.Fatalf("LoadWithOptions failed: %v", err)
+	}
+	for key, value := range env {
+		if loaded[key] != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, loaded[key])
+		}
+	}
 }
 
 func TestMarshalErrors(t *testing.T) {
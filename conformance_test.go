@@ -0,0 +1,79 @@
+package dotenv
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestComposeConformance checks the Compose dialect against the corpus in
+// testdata/compose. Each NAME.env is paired with NAME.json holding the
+// expected variables, or NAME.err holding the expected error message.
+func TestComposeConformance(t *testing.T) {
+	runConformance(t, "testdata/compose", Options{Dialect: DialectCompose})
+}
+
+// TestSystemdConformance checks the systemd dialect against the corpus in
+// testdata/systemd
+func TestSystemdConformance(t *testing.T) {
+	runConformance(t, "testdata/systemd", Options{Dialect: DialectSystemd})
+}
+
+func runConformance(t *testing.T, dir string, opts Options) {
+	inputs, err := filepath.Glob(filepath.Join(dir, "*.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no test cases in %s", dir)
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".env")
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env, parseErr := NewParserWithOptions(string(content), opts).Parse()
+
+			base := strings.TrimSuffix(input, ".env")
+			if want, err := os.ReadFile(base + ".err"); err == nil {
+				if parseErr == nil {
+					t.Fatalf("expected error %q, got %v", strings.TrimSpace(string(want)), env)
+				}
+				if !strings.Contains(parseErr.Error(), strings.TrimSpace(string(want))) {
+					t.Errorf("expected error containing %q, got %q", strings.TrimSpace(string(want)), parseErr)
+				}
+				return
+			}
+
+			if parseErr != nil {
+				t.Fatalf("unexpected error: %v", parseErr)
+			}
+			data, err := os.ReadFile(base + ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want map[string]string
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatalf("invalid %s.json: %v", name, err)
+			}
+
+			for key, value := range want {
+				if got, ok := env[key]; !ok {
+					t.Errorf("%s: missing", key)
+				} else if got != value {
+					t.Errorf("%s: expected %q, got %q", key, value, got)
+				}
+			}
+			for key := range env {
+				if _, ok := want[key]; !ok {
+					t.Errorf("%s: unexpected key", key)
+				}
+			}
+		})
+	}
+}
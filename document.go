@@ -0,0 +1,324 @@
+package dotenv
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Document is a lossless representation of .env content. It keeps every
+// comment, blank line, ordering, export prefix and quote style, so it can be
+// edited and written back with untouched regions reproduced exactly.
+type Document struct {
+	lines   []*docLine
+	options Options
+}
+
+// docLine is one line of a document. Lines without a key hold comments,
+// blank lines or other trivia. A quoted value spanning several source lines
+// belongs to a single docLine.
+type docLine struct {
+	raw      string // source text including the line terminator
+	key      string
+	value    string
+	quote    QuoteStyle
+	exported bool
+	bare     bool // key without '=', such as "export PATH"
+
+	// spans of the key and value within raw
+	keyStart, keyEnd     int
+	valueStart, valueEnd int
+	markerEnd            int // end of the "<<EOF" marker of a heredoc value
+}
+
+// ParseDocument parses content into an editable Document
+func ParseDocument(content string) (*Document, error) {
+	return ParseDocumentWithOptions(content, Options{})
+}
+
+// ParseDocumentWithOptions parses content into an editable Document using
+// the grammar settings in opts
+func ParseDocumentWithOptions(content string, opts Options) (*Document, error) {
+	doc := &Document{options: opts.withDialect()}
+	tokenizer := NewTokenizerWithOptions(content, opts)
+	line := &docLine{}
+	start := 0
+	assigned := false
+
+	for {
+		tok, err := tokenizer.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok.Type {
+		case TokenExport:
+			line.exported = true
+
+		case TokenKey:
+			line.key = tok.Value
+			line.keyStart = tok.Pos - start
+			line.keyEnd = line.keyStart + len(tok.Raw)
+
+		case TokenAssign:
+			assigned = true
+
+		case TokenValue:
+			line.value = tok.Value
+			line.quote = tok.Quote
+			line.valueStart = tok.Pos - start
+			line.valueEnd = line.valueStart + len(tok.Raw)
+			line.markerEnd = line.valueStart + tok.markerLen
+
+		case TokenNewline, TokenEOF:
+			end := tok.Pos + len(tok.Raw)
+			line.raw = content[start:end]
+			if line.key != "" && !assigned {
+				line.bare = true
+				line.valueStart, line.valueEnd = line.keyEnd, line.keyEnd
+			}
+			if line.raw != "" {
+				doc.lines = append(doc.lines, line)
+			}
+			if tok.Type == TokenEOF {
+				return doc, nil
+			}
+			start = end
+			line = &docLine{}
+			assigned = false
+		}
+	}
+}
+
+// Get returns the value of the last definition of key as a loader reads
+// it, with variables expanded. Set stores values literally, so
+// Set(key, value) with the returned value keeps the meaning of the key.
+func (d *Document) Get(key string) (string, bool) {
+	i := d.find(key)
+	if i < 0 {
+		return "", false
+	}
+
+	entries, _, _ := NewParserWithOptions(d.String(), d.options).parse()
+	for j := len(entries) - 1; j >= 0; j-- {
+		if entries[j].Key == key {
+			return entries[j].Value, true
+		}
+	}
+
+	// The definition could not be expanded
+	return d.lines[i].value, true
+}
+
+// Keys returns the defined keys in the order they first appear
+func (d *Document) Keys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, line := range d.lines {
+		if line.key != "" && !seen[line.key] {
+			seen[line.key] = true
+			keys = append(keys, line.key)
+		}
+	}
+	return keys
+}
+
+// Set sets the value of key. An existing definition keeps its position,
+// export prefix, surrounding whitespace, trailing comment and, where the new
+// value allows, its quote style. A new key is appended to the end.
+func (d *Document) Set(key, value string) error {
+	if i := d.find(key); i >= 0 {
+		d.lines[i].setValue(value, d.options)
+		return nil
+	}
+
+	line, err := d.newLine(key, value)
+	if err != nil {
+		return err
+	}
+	d.terminate(len(d.lines) - 1)
+	d.lines = append(d.lines, line)
+	return nil
+}
+
+// Delete removes every definition of key and reports whether any existed
+func (d *Document) Delete(key string) bool {
+	lines := d.lines[:0]
+	for _, line := range d.lines {
+		if line.key != key {
+			lines = append(lines, line)
+		}
+	}
+	deleted := len(lines) != len(d.lines)
+	d.lines = lines
+	return deleted
+}
+
+// Rename renames every definition of oldKey to newKey
+func (d *Document) Rename(oldKey, newKey string) error {
+	if d.find(oldKey) < 0 {
+		return fmt.Errorf("key %s is not defined", oldKey)
+	}
+	if !isValidKey(newKey, d.options) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, newKey)
+	}
+	if oldKey != newKey && d.find(newKey) >= 0 {
+		return fmt.Errorf("key %s is already defined", newKey)
+	}
+
+	for _, line := range d.lines {
+		if line.key == oldKey {
+			line.raw = line.raw[:line.keyStart] + newKey + line.raw[line.keyEnd:]
+			shift := len(newKey) - (line.keyEnd - line.keyStart)
+			line.keyEnd += shift
+			line.valueStart += shift
+			line.valueEnd += shift
+			line.key = newKey
+		}
+	}
+	return nil
+}
+
+// InsertAfter inserts a new definition of key directly after the last
+// definition of after
+func (d *Document) InsertAfter(after, key, value string) error {
+	i := d.find(after)
+	if i < 0 {
+		return fmt.Errorf("key %s is not defined", after)
+	}
+	if d.find(key) >= 0 {
+		return fmt.Errorf("key %s is already defined", key)
+	}
+
+	line, err := d.newLine(key, value)
+	if err != nil {
+		return err
+	}
+	d.terminate(i)
+	d.lines = append(d.lines, nil)
+	copy(d.lines[i+2:], d.lines[i+1:])
+	d.lines[i+1] = line
+	return nil
+}
+
+// WriteTo writes the document to w, implementing io.WriterTo
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, line := range d.lines {
+		n, err := io.WriteString(w, line.raw)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// String returns the content of the document
+func (d *Document) String() string {
+	var b strings.Builder
+	d.WriteTo(&b)
+	return b.String()
+}
+
+// find returns the index of the last line defining key, or -1
+func (d *Document) find(key string) int {
+	for i := len(d.lines) - 1; i >= 0; i-- {
+		if d.lines[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// newline returns the line terminator used by the document
+func (d *Document) newline() string {
+	for _, line := range d.lines {
+		if strings.HasSuffix(line.raw, "\r\n") {
+			return "\r\n"
+		}
+	}
+	return "\n"
+}
+
+// terminate makes sure line i ends with a line terminator
+func (d *Document) terminate(i int) {
+	if i >= 0 && !strings.HasSuffix(d.lines[i].raw, "\n") {
+		d.lines[i].raw += d.newline()
+	}
+}
+
+// newLine builds a KEY=value line for insertion
+func (d *Document) newLine(key, value string) (*docLine, error) {
+	if !isValidKey(key, d.options) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	line := &docLine{
+		raw:        key + "=" + d.newline(),
+		key:        key,
+		keyEnd:     len(key),
+		valueStart: len(key) + 1,
+		valueEnd:   len(key) + 1,
+	}
+	line.setValue(value, d.options)
+	return line, nil
+}
+
+// setValue replaces the value of the line, keeping everything around it
+func (l *docLine) setValue(value string, opts Options) {
+	raw, quote := formatValue(value, l.quote, opts)
+
+	// A bare key becomes an assignment
+	if l.bare {
+		l.raw = l.raw[:l.keyEnd] + "=" + l.raw[l.keyEnd:]
+		l.valueStart, l.valueEnd = l.keyEnd+1, l.keyEnd+1
+		l.bare = false
+	}
+
+	// A heredoc is replaced with its body, keeping what follows the marker
+	// on the opening line, such as a comment
+	rest := l.raw[l.valueEnd:]
+	if l.quote == QuoteHeredoc {
+		opening, _, _ := strings.Cut(l.raw[l.markerEnd:l.valueEnd], "\n")
+		rest = strings.TrimSuffix(opening, "\r") + rest
+	}
+
+	// Keep a trailing comment separated from an unquoted value
+	if quote == QuoteNone && raw != "" && strings.HasPrefix(rest, "#") {
+		raw += " "
+	}
+
+	l.raw = l.raw[:l.valueStart] + raw + rest
+	l.valueEnd = l.valueStart + len(raw)
+	l.value = value
+	l.quote = quote
+}
+
+// formatValue renders value for writing in the dialect of opts, keeping the
+// preferred quote style when it can represent the value
+func formatValue(value string, preferred QuoteStyle, opts Options) (string, QuoteStyle) {
+	switch {
+	case preferred == QuoteSingle && !strings.Contains(value, "'"):
+		return "'" + value + "'", QuoteSingle
+	case preferred == QuoteBacktick && !strings.ContainsAny(value, "`$"):
+		return "`" + value + "`", QuoteBacktick
+	case preferred == QuoteDouble || needsQuoting(value, opts):
+		return quoteValueFor(value, opts), QuoteDouble
+	default:
+		return value, QuoteNone
+	}
+}
+
+// isValidKey checks if the whole string is a valid key name
+func isValidKey(key string, opts Options) bool {
+	if key == "" || !isValidKeyStart(key[0]) {
+		return false
+	}
+	for i := 1; i < len(key); i++ {
+		if !isKeyChar(key[i], opts) {
+			return false
+		}
+	}
+	return true
+}
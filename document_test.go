@@ -0,0 +1,231 @@
+package dotenv
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+const documentContent = `# Database settings
+export DB_HOST=localhost   # primary host
+
+DB_PASSWORD='s3cret'
+DB_NAME="app"
+  DB_PORT = 5432
+OPTIONAL=
+`
+
+func TestDocumentRoundTrip(t *testing.T) {
+	inputs := []string{
+		documentContent,
+		"KEY=value",
+		"\r\n# crlf\r\nA=1\r\nB=\"x\ny\"\r\n",
+		"",
+	}
+
+	for _, input := range inputs {
+		doc, err := ParseDocument(input)
+		if err != nil {
+			t.Fatalf("ParseDocument failed: %v", err)
+		}
+		assertRoundTrip(t, doc, input)
+	}
+
+	// Heredocs and backticks need their grammar switches
+	input := "CERT=<<-EOF # comment\n\tline one\n\tEOF\nTAIL=`multi\nline`\n"
+	doc, err := ParseDocumentWithOptions(input, Options{Heredocs: true, Backticks: true})
+	if err != nil {
+		t.Fatalf("ParseDocumentWithOptions failed: %v", err)
+	}
+	assertRoundTrip(t, doc, input)
+}
+
+// assertRoundTrip checks that doc writes back exactly input
+func assertRoundTrip(t *testing.T, doc *Document, input string) {
+	t.Helper()
+	var b strings.Builder
+	n, err := doc.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if b.String() != input || n != int64(len(input)) {
+		t.Errorf("Round trip mismatch: expected %q, got %q (%d bytes)", input, b.String(), n)
+	}
+}
+
+func TestDocumentEdits(t *testing.T) {
+	doc, err := ParseDocument(documentContent)
+	if err != nil {
+		t.Fatalf("ParseDocument failed: %v", err)
+	}
+
+	if err := doc.Set("DB_HOST", "db.internal"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := doc.Set("DB_PASSWORD", "new pass"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := doc.Set("DB_NAME", "it's"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := doc.Set("NEW_KEY", "with space"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := doc.Rename("DB_PORT", "DATABASE_PORT"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := doc.InsertAfter("DB_HOST", "DB_USER", "admin"); err != nil {
+		t.Fatalf("InsertAfter failed: %v", err)
+	}
+	if !doc.Delete("OPTIONAL") {
+		t.Error("Expected Delete to report an existing key")
+	}
+
+	expected := `# Database settings
+export DB_HOST=db.internal   # primary host
+DB_USER=admin
+
+DB_PASSWORD='new pass'
+DB_NAME="it's"
+  DATABASE_PORT = 5432
+NEW_KEY="with space"
+`
+	if doc.String() != expected {
+		t.Errorf("Expected document:\n%s\ngot:\n%s", expected, doc.String())
+	}
+
+	// The edited document still parses to the expected values
+	env, err := NewParser(doc.String()).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if env["DB_PASSWORD"] != "new pass" || env["DATABASE_PORT"] != "5432" || env["DB_USER"] != "admin" {
+		t.Errorf("Unexpected parsed values: %v", env)
+	}
+}
+
+func TestDocumentEditErrors(t *testing.T) {
+	doc, err := ParseDocument("A=1\nB=2")
+	if err != nil {
+		t.Fatalf("ParseDocument failed: %v", err)
+	}
+
+	if err := doc.Rename("MISSING", "C"); err == nil {
+		t.Error("Expected error renaming a missing key")
+	}
+	if err := doc.Rename("A", "B"); err == nil {
+		t.Error("Expected error renaming onto an existing key")
+	}
+	if err := doc.Set("1BAD", "x"); err == nil {
+		t.Error("Expected error for invalid key")
+	}
+	if err := doc.InsertAfter("MISSING", "C", "3"); err == nil {
+		t.Error("Expected error inserting after a missing key")
+	}
+	if doc.Delete("MISSING") {
+		t.Error("Expected Delete to report a missing key")
+	}
+
+	// Appending to a document without a final newline terminates the last line
+	if err := doc.Set("C", "3"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if doc.String() != "A=1\nB=2\nC=3\n" {
+		t.Errorf("Unexpected document %q", doc.String())
+	}
+
+	if _, err := ParseDocument("A=\"unterminated"); err == nil {
+		t.Error("Expected error for invalid content")
+	}
+}
+
+func TestDocumentBareKeys(t *testing.T) {
+	input := "export PATH # inherited\nDEBUG\n"
+	doc, err := ParseDocument(input)
+	if err != nil {
+		t.Fatalf("ParseDocument failed: %v", err)
+	}
+	if doc.String() != input {
+		t.Errorf("Round trip mismatch: expected %q, got %q", input, doc.String())
+	}
+
+	if err := doc.Set("PATH", "/bin"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := doc.Set("DEBUG", "true"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	expected := "export PATH=/bin # inherited\nDEBUG=true\n"
+	if doc.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, doc.String())
+	}
+}
+
+func TestDocumentSetHeredoc(t *testing.T) {
+	opts := Options{Heredocs: true}
+	tests := []struct {
+		input    string
+		value    string
+		expected string
+	}{
+		{"CERT=<<EOF # pem\nabc\nEOF\nNEXT=1\n", "new", "CERT=new # pem\nNEXT=1\n"},
+		{"CERT=<<-'EOF'\t# pem\r\n\tabc\r\n\tEOF\r\n", "two words", "CERT=\"two words\"\t# pem\r\n"},
+		{"CERT=<<EOF\nabc\nEOF\n", "new", "CERT=new\n"},
+		{"CERT=<<'END MARK' # c\nabc\nEND MARK\n", "new", "CERT=new # c\n"},
+	}
+
+	for _, tt := range tests {
+		doc, err := ParseDocumentWithOptions(tt.input, opts)
+		if err != nil {
+			t.Fatalf("ParseDocumentWithOptions failed: %v", err)
+		}
+		assertRoundTrip(t, doc, tt.input)
+
+		if err := doc.Set("CERT", tt.value); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if doc.String() != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, doc.String())
+		}
+		if value, _ := doc.Get("CERT"); value != tt.value {
+			t.Errorf("Expected CERT=%q, got %q", tt.value, value)
+		}
+
+		// The edited document reads back the new value
+		env, err := NewParserWithOptions(doc.String(), opts).Parse()
+		if err != nil || env["CERT"] != tt.value {
+			t.Errorf("Expected CERT=%q after re-parsing, got %v, %v", tt.value, env, err)
+		}
+	}
+}
+
+func TestDocumentGetSet(t *testing.T) {
+	input := "B=x\nA=\"$B/y\"\nLITERAL=\"\\$B\"\nSINGLE='$B'\nDEFAULT=${UNSET_DOC_KEY:-fallback}\n"
+	doc, err := ParseDocument(input)
+	if err != nil {
+		t.Fatalf("ParseDocument failed: %v", err)
+	}
+	before, err := NewParser(input).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if value, _ := doc.Get("A"); value != "x/y" {
+		t.Errorf("Expected A=x/y, got %q", value)
+	}
+
+	// Setting a key to its own value keeps its meaning
+	for _, key := range doc.Keys() {
+		value, _ := doc.Get(key)
+		if err := doc.Set(key, value); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	after, err := NewParser(doc.String()).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !maps.Equal(before, after) {
+		t.Errorf("Expected %v, got %v from %q", before, after, doc.String())
+	}
+}
@@ -8,7 +8,12 @@ The package is organized into several files:
 - token.go: Token types and definitions
 - tokenizer.go: Lexical analysis and tokenization
 - parser.go: Parsing logic and state machine
+- expand.go: Variable expansion
+- errors.go: Structured parse errors
+- document.go: Lossless document model for editing
+- encoding.go: Byte order marks, line endings and UTF-16 input
 - env.go: Main API functions for external users
+- find.go: Locating the nearest .env file in parent directories, on disk or in an fs.FS
 
 Basic usage:
 
@@ -18,7 +23,7 @@ Basic usage:
 	}
 
 	// Apply to current process
-	err = dotenv.Apply(env)
+	_, err = dotenv.Apply(env)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -1,6 +1,12 @@
 package dotenv
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -138,7 +144,7 @@ func TestEscapeSequences(t *testing.T) {
 TAB="col1\tcol2"
 BACKSLASH="path\\to\\file"
 QUOTE="say \"hello\""
-UNKNOWN_ESCAPE="test\x"`
+UNKNOWN_ESCAPE="test\q"`
 	parser := NewParser(content)
 	env, err := parser.Parse()
 	if err != nil {
@@ -150,7 +156,7 @@ UNKNOWN_ESCAPE="test\x"`
 		"TAB":            "col1\tcol2",
 		"BACKSLASH":      "path\\to\\file",
 		"QUOTE":          "say \"hello\"",
-		"UNKNOWN_ESCAPE": "test\\x", // unknown escapes should preserve backslash
+		"UNKNOWN_ESCAPE": "test\\q", // unknown escapes should preserve backslash
 	}
 
 	for k, v := range expected {
@@ -192,6 +198,206 @@ NO_EXPAND='$HOME_DIR/literal'`
 	}
 }
 
+func TestParameterExpansion(t *testing.T) {
+	content := `SET=value
+EMPTY=
+DEFAULT_UNSET=${MISSING:-fallback}
+DEFAULT_EMPTY=${EMPTY:-fallback}
+DASH_UNSET=${MISSING-fallback}
+DASH_EMPTY=${EMPTY-fallback}
+DEFAULT_SET=${SET:-fallback}
+ASSIGN=${ASSIGNED:=assigned}
+ASSIGNED_AFTER=$ASSIGNED
+ALT_SET=${SET:+alternate}
+ALT_EMPTY=${EMPTY:+alternate}
+ALT_UNSET=${MISSING+alternate}
+NESTED="${MISSING:-${SET}/nested}"
+CHECKED=${SET:?must be set}
+UNKNOWN=${MISSING}`
+
+	parser := NewParser(content)
+	env, err := parser.Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"DEFAULT_UNSET":  "fallback",
+		"DEFAULT_EMPTY":  "fallback",
+		"DASH_UNSET":     "fallback",
+		"DASH_EMPTY":     "",
+		"DEFAULT_SET":    "value",
+		"ASSIGN":         "assigned",
+		"ASSIGNED":       "assigned",
+		"ASSIGNED_AFTER": "assigned",
+		"ALT_SET":        "alternate",
+		"ALT_EMPTY":      "",
+		"ALT_UNSET":      "",
+		"NESTED":         "value/nested",
+		"CHECKED":        "value",
+		"UNKNOWN":        "${MISSING}", // unknown references are kept literally
+	}
+
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("Expected %s=%q, got %s=%q", k, v, k, env[k])
+		}
+	}
+}
+
+func TestParameterExpansionError(t *testing.T) {
+	content := `FIRST=1
+REQUIRED=${TOKEN:?token is required}`
+
+	parser := NewParser(content)
+	_, err := parser.Parse()
+	if err == nil {
+		t.Fatal("Expected error for unset required variable")
+	}
+
+	for _, want := range []string{"REQUIRED", "line 2", "token is required"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %q", want, err.Error())
+		}
+	}
+}
+
+func TestLookupExpansion(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		switch key {
+		case "HOME":
+			return "/home/process", true
+		case "SHARED":
+			return "from-process", true
+		}
+		return "", false
+	}
+
+	content := `SHARED=from-file
+DATA_DIR=$HOME/data
+WHICH=${SHARED}
+MISSING=$NOT_ANYWHERE`
+
+	env, err := NewParserWithOptions(content, Options{Lookup: lookup}).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"DATA_DIR": "/home/process/data",
+		"WHICH":    "from-file", // file values win by default
+		"MISSING":  "$NOT_ANYWHERE",
+	}
+
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("Expected %s=%q, got %s=%q", k, v, k, env[k])
+		}
+	}
+
+	env, err = NewParserWithOptions(content, Options{Lookup: lookup, PreferLookup: true}).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if env["WHICH"] != "from-process" {
+		t.Errorf("Expected WHICH=%q with PreferLookup, got %q", "from-process", env["WHICH"])
+	}
+}
+
+func TestDeferredExpansion(t *testing.T) {
+	content := `URL=http://$HOST:${PORT}/
+HOST=db
+PORT=${DEFAULT_PORT:-5432}
+PATH=$PATH:/opt/bin`
+
+	opts := Options{
+		Expansion: ExpandDeferred,
+		Lookup: func(key string) (string, bool) {
+			if key == "PATH" {
+				return "/usr/bin", true
+			}
+			return "", false
+		},
+	}
+
+	env, err := NewParserWithOptions(content, opts).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"URL":  "http://db:5432/",
+		"HOST": "db",
+		"PORT": "5432",
+		"PATH": "/usr/bin:/opt/bin", // self references resolve through the lookup
+	}
+
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("Expected %s=%q, got %s=%q", k, v, k, env[k])
+		}
+	}
+}
+
+func TestDeferredExpansionCycle(t *testing.T) {
+	content := `A=$B
+B=${C}
+C=x$A
+D=$A`
+
+	_, err := NewParserWithOptions(content, Options{Expansion: ExpandDeferred}).Parse()
+	if err == nil {
+		t.Fatal("Expected error for reference cycle")
+	}
+
+	if !errors.Is(err, ErrReferenceCycle) {
+		t.Errorf("Expected ErrReferenceCycle, got %v", err)
+	}
+
+	want := "A (line 1) -> B (line 2) -> C (line 3) -> A"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected error to contain %q, got %q", want, err.Error())
+	}
+}
+
+func TestEscapedDollar(t *testing.T) {
+	content := `USER=admin
+PASSWORD="pa\$\$word\$USER"
+UNQUOTED=cost\$5 for $USER
+DEFAULT="${MISSING:-\${USER}}"
+SINGLE='stays\$USER'`
+
+	env, err := NewParser(content).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"PASSWORD": "pa$$word$USER",
+		"UNQUOTED": "cost$5 for admin",
+		"DEFAULT":  "${USER}",
+		"SINGLE":   "stays\\$USER", // single quotes keep the backslash
+	}
+
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("Expected %s=%q, got %s=%q", k, v, k, env[k])
+		}
+	}
+
+	// Escaped references are not dependencies in deferred mode
+	content = `A="\$B"
+B=$A`
+	env, err = NewParserWithOptions(content, Options{Expansion: ExpandDeferred}).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if env["B"] != "$B" {
+		t.Errorf("Expected B=%q, got %q", "$B", env["B"])
+	}
+}
+
 func TestEmptyValues(t *testing.T) {
 	content := `EMPTY1=
 EMPTY2=""
@@ -259,6 +465,244 @@ func TestErrorCases(t *testing.T) {
 	}
 }
 
+func TestParseErrorDetails(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		sentinel error
+		kind     ErrorKind
+		line     int
+		col      int
+		key      string
+		snippet  string
+	}{
+		{
+			name:     "unterminated quote",
+			content:  "A=1\nKEY=\"unterminated\nB=2",
+			sentinel: ErrUnterminatedQuote,
+			kind:     KindUnterminatedQuote,
+			line:     2,
+			col:      5,
+			key:      "KEY",
+			snippet:  "KEY=\"unterminated\n    ^",
+		},
+		{
+			name:     "invalid key",
+			content:  "  123INVALID=value",
+			sentinel: ErrInvalidKey,
+			kind:     KindInvalidKey,
+			line:     1,
+			col:      3,
+			snippet:  "  123INVALID=value\n  ^",
+		},
+		{
+			name:     "missing assign",
+			content:  "# comment\nKEY value",
+			sentinel: ErrMissingAssign,
+			kind:     KindMissingAssign,
+			line:     2,
+			col:      5,
+			key:      "KEY",
+			snippet:  "KEY value\n    ^",
+		},
+		{
+			name:     "unset variable",
+			content:  "KEY=${TOKEN:?required}",
+			sentinel: ErrUnsetVariable,
+			kind:     KindUnsetVariable,
+			line:     1,
+			col:      5,
+			key:      "KEY",
+			snippet:  "KEY=${TOKEN:?required}\n    ^",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewParserWithOptions(tc.content, Options{Filename: "test.env"}).Parse()
+			if !errors.Is(err, tc.sentinel) {
+				t.Fatalf("Expected %v, got %v", tc.sentinel, err)
+			}
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Expected *ParseError, got %T", err)
+			}
+
+			if parseErr.Filename != "test.env" || parseErr.Line != tc.line || parseErr.Col != tc.col {
+				t.Errorf("Expected location test.env:%d:%d, got %s:%d:%d",
+					tc.line, tc.col, parseErr.Filename, parseErr.Line, parseErr.Col)
+			}
+			if parseErr.Kind != tc.kind {
+				t.Errorf("Expected kind %s, got %s", tc.kind, parseErr.Kind)
+			}
+			if parseErr.Key != tc.key {
+				t.Errorf("Expected key %q, got %q", tc.key, parseErr.Key)
+			}
+			if parseErr.Snippet() != tc.snippet {
+				t.Errorf("Expected snippet %q, got %q", tc.snippet, parseErr.Snippet())
+			}
+		})
+	}
+}
+
+func TestParseAllRecovers(t *testing.T) {
+	content := `GOOD1=one
+123BAD=value
+MISSING_ASSIGN value
+GOOD2="two"
+UNTERMINATED="oops
+GOOD3=${GOOD1}-three
+REQUIRED=${NOPE:?must be set}`
+
+	env, err := NewParser(content).ParseAll()
+	if err == nil {
+		t.Fatal("Expected errors for bad lines")
+	}
+
+	expected := map[string]string{
+		"GOOD1": "one",
+		"GOOD2": "two",
+		"GOOD3": "one-three",
+	}
+	if len(env) != len(expected) {
+		t.Errorf("Expected %d valid entries, got %d: %v", len(expected), len(env), env)
+	}
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("Expected %s=%q, got %s=%q", k, v, k, env[k])
+		}
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Expected joined error, got %T", err)
+	}
+
+	wantLines := []int{2, 3, 5, 7}
+	errs := joined.Unwrap()
+	if len(errs) != len(wantLines) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(wantLines), len(errs), err)
+	}
+	for i, e := range errs {
+		var parseErr *ParseError
+		if !errors.As(e, &parseErr) {
+			t.Fatalf("Expected *ParseError, got %T", e)
+		}
+		if parseErr.Line != wantLines[i] {
+			t.Errorf("Expected error %d at line %d, got line %d", i, wantLines[i], parseErr.Line)
+		}
+	}
+
+	// Errors are reported in file order, whatever stage finds them
+	content = "A=${X:?need X}\nB C\nDOTENV_ORDER_UNSET\nE=\"open"
+	_, err = NewParser(content).Parse()
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 1 || !errors.Is(err, ErrUnsetVariable) {
+		t.Errorf("Expected the unset variable on line 1 first, got %v", err)
+	}
+	_, err = NewParser(content).ParseAll()
+	var lines []int
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		if errors.As(e, &parseErr) {
+			lines = append(lines, parseErr.Line)
+		}
+	}
+	if !slices.Equal(lines, []int{1, 2, 3, 4}) {
+		t.Errorf("Expected errors on lines 1 to 4 in order, got %v", lines)
+	}
+
+	// Valid content reports no error
+	env, err = NewParser("A=1\nB=2").ParseAll()
+	if err != nil || len(env) != 2 {
+		t.Errorf("Expected 2 entries and no error, got %v, %v", env, err)
+	}
+}
+
+func TestTokenizerNext(t *testing.T) {
+	content := "# header\nexport KEY = \"a b\" # note\r\nOTHER='x'\nEMPTY=\n  PLAIN=v\\$1 "
+
+	type want struct {
+		typ   TokenType
+		value string
+		raw   string
+		quote QuoteStyle
+		line  int
+		col   int
+	}
+	expected := []want{
+		{TokenComment, " header", "# header", QuoteNone, 1, 1},
+		{TokenNewline, "\n", "\n", QuoteNone, 1, 9},
+		{TokenExport, "export", "export", QuoteNone, 2, 1},
+		{TokenKey, "KEY", "KEY", QuoteNone, 2, 8},
+		{TokenAssign, "=", "=", QuoteNone, 2, 12},
+		{TokenValue, "a b", "\"a b\"", QuoteDouble, 2, 14},
+		{TokenComment, " note", "# note", QuoteNone, 2, 20},
+		{TokenNewline, "\r\n", "\r\n", QuoteNone, 2, 26},
+		{TokenKey, "OTHER", "OTHER", QuoteNone, 3, 1},
+		{TokenAssign, "=", "=", QuoteNone, 3, 6},
+		{TokenValue, "x", "'x'", QuoteSingle, 3, 7},
+		{TokenNewline, "\n", "\n", QuoteNone, 3, 10},
+		{TokenKey, "EMPTY", "EMPTY", QuoteNone, 4, 1},
+		{TokenAssign, "=", "=", QuoteNone, 4, 6},
+		{TokenValue, "", "", QuoteNone, 4, 7},
+		{TokenNewline, "\n", "\n", QuoteNone, 4, 7},
+		{TokenKey, "PLAIN", "PLAIN", QuoteNone, 5, 3},
+		{TokenAssign, "=", "=", QuoteNone, 5, 8},
+		{TokenValue, "v$1", "v\\$1", QuoteNone, 5, 9},
+		{TokenEOF, "", "", QuoteNone, 5, 14},
+	}
+
+	tokenizer := NewTokenizer(content)
+	for i, w := range expected {
+		tok, err := tokenizer.Next()
+		if err != nil {
+			t.Fatalf("Token %d: unexpected error: %v", i, err)
+		}
+		if tok.Type != w.typ || tok.Value != w.value || tok.Raw != w.raw || tok.Quote != w.quote ||
+			tok.Line != w.line || tok.Col != w.col {
+			t.Errorf("Token %d: expected %s %q %q %s at %d:%d, got %s %q %q %s at %d:%d", i,
+				w.typ, w.value, w.raw, w.quote, w.line, w.col,
+				tok.Type, tok.Value, tok.Raw, tok.Quote, tok.Line, tok.Col)
+		}
+		if content[tok.Pos:tok.Pos+len(tok.Raw)] != tok.Raw {
+			t.Errorf("Token %d: Raw %q does not match content at Pos %d", i, tok.Raw, tok.Pos)
+		}
+	}
+}
+
+func TestTokenizerRecovers(t *testing.T) {
+	tokenizer := NewTokenizer("BAD value\nKEY=\"a\" junk\nGOOD=1")
+
+	var types []TokenType
+	var errs []error
+	for {
+		tok, err := tokenizer.Next()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		types = append(types, tok.Type)
+		if tok.Type == TokenEOF {
+			break
+		}
+	}
+
+	if len(errs) != 2 || !errors.Is(errs[0], ErrMissingAssign) || !errors.Is(errs[1], ErrTrailingText) {
+		t.Errorf("Expected missing assign and trailing text errors, got %v", errs)
+	}
+
+	expected := []TokenType{TokenKey, TokenKey, TokenAssign, TokenValue, TokenKey, TokenAssign, TokenValue, TokenEOF}
+	if len(types) != len(expected) {
+		t.Fatalf("Expected tokens %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("Token %d: expected %s, got %s", i, expected[i], types[i])
+		}
+	}
+}
+
 func TestComplexRealWorldExample(t *testing.T) {
 	content := `# Database configuration
 DB_HOST=localhost
@@ -319,6 +763,191 @@ MESSAGE="Line 1\nLine 2\tTabbed"
 	}
 }
 
+func TestParseEntries(t *testing.T) {
+	content := `# comment
+ZEBRA=1
+export APPLE="${ZEBRA}-a"
+
+MANGO='$ZEBRA'
+ZEBRA=2`
+
+	entries, err := NewParser(content).ParseEntries()
+	if err != nil {
+		t.Fatalf("ParseEntries failed: %v", err)
+	}
+
+	expected := []Entry{
+		{Key: "ZEBRA", Value: "1", RawValue: "1", Quote: QuoteNone, Line: 2},
+		{Key: "APPLE", Value: "1-a", RawValue: "${ZEBRA}-a", Quote: QuoteDouble, Line: 3, Exported: true},
+		{Key: "MANGO", Value: "$ZEBRA", RawValue: "$ZEBRA", Quote: QuoteSingle, Line: 5},
+		{Key: "ZEBRA", Value: "2", RawValue: "2", Quote: QuoteNone, Line: 6},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d: %+v", len(expected), len(entries), entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, expected[i], entries[i])
+		}
+	}
+
+	// Entries read through a reader keep the same order
+	entries, err = LoadEntriesFromReader(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("LoadEntriesFromReader failed: %v", err)
+	}
+	if len(entries) != 4 || entries[1].Key != "APPLE" {
+		t.Errorf("Unexpected entries from reader: %+v", entries)
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	content := `HOST=first
+URL=http://$HOST
+HOST=second`
+
+	testCases := []struct {
+		name   string
+		policy DuplicatePolicy
+		host   string
+		url    string
+	}{
+		{"last wins", DuplicateLastWins, "second", "http://first"},
+		{"first wins", DuplicateFirstWins, "first", "http://first"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parser := NewParserWithOptions(content, Options{Duplicates: tc.policy})
+			env, err := parser.Parse()
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if env["HOST"] != tc.host || env["URL"] != tc.url {
+				t.Errorf("Expected HOST=%q URL=%q, got HOST=%q URL=%q", tc.host, tc.url, env["HOST"], env["URL"])
+			}
+
+			warnings := parser.Warnings()
+			if len(warnings) != 1 || !errors.Is(warnings[0], ErrDuplicateKey) {
+				t.Fatalf("Expected one duplicate key warning, got %v", warnings)
+			}
+			if !strings.Contains(warnings[0].Error(), "line 3") || !strings.Contains(warnings[0].Error(), "line 1") {
+				t.Errorf("Expected warning to name both lines, got %q", warnings[0].Error())
+			}
+		})
+	}
+
+	_, err := NewParserWithOptions(content, Options{Duplicates: DuplicateError}).Parse()
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("Expected ErrDuplicateKey, got %v", err)
+	}
+	want := "line 3, column 1: HOST: duplicate key: previously defined at line 1"
+	if err.Error() != want {
+		t.Errorf("Expected error %q, got %q", want, err.Error())
+	}
+
+	// The ordered API lists every definition and reports the duplicate
+	parser := NewParser(content)
+	entries, err := parser.ParseEntries()
+	if err != nil {
+		t.Fatalf("ParseEntries failed: %v", err)
+	}
+	if len(entries) != 3 || len(parser.Warnings()) != 1 {
+		t.Errorf("Expected 3 entries and 1 warning, got %d and %d", len(entries), len(parser.Warnings()))
+	}
+}
+
+func TestGrammarOptions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		opts     Options
+		expected map[string]string
+		wantErr  error
+	}{
+		{
+			name:    "export disabled",
+			content: "export KEY=value",
+			opts:    Options{DisableExport: true},
+			wantErr: ErrMissingAssign,
+		},
+		{
+			name:     "dots and dashes in keys",
+			content:  "app.name=demo\nlog-level=debug",
+			opts:     Options{AllowDotsInKeys: true, AllowDashesInKeys: true},
+			expected: map[string]string{"app.name": "demo", "log-level": "debug"},
+		},
+		{
+			name:    "dots rejected by default",
+			content: "app.name=demo",
+			wantErr: ErrMissingAssign,
+		},
+		{
+			name:     "comment needs space",
+			content:  "URL=https://host/page#anchor\nCOLOR=#ff0000\nPORT=80 # comment\nEMPTY= # comment",
+			opts:     Options{CommentNeedsSpace: true},
+			expected: map[string]string{"URL": "https://host/page#anchor", "COLOR": "#ff0000", "PORT": "80", "EMPTY": ""},
+		},
+		{
+			name:     "expansion disabled",
+			content:  "A=1\nB=\"$A ${A:-x}\"",
+			opts:     Options{Expansion: ExpandNone},
+			expected: map[string]string{"A": "1", "B": "$A ${A:-x}"},
+		},
+		{
+			name:     "strict assign accepts tight assignments",
+			content:  "KEY=value",
+			opts:     Options{StrictAssign: true},
+			expected: map[string]string{"KEY": "value"},
+		},
+		{
+			name:    "strict assign rejects space before equals",
+			content: "KEY =value",
+			opts:    Options{StrictAssign: true},
+			wantErr: ErrInvalidWhitespace,
+		},
+		{
+			name:    "strict assign rejects space after equals",
+			content: "KEY= value",
+			opts:    Options{StrictAssign: true},
+			wantErr: ErrInvalidWhitespace,
+		},
+		{
+			name:     "value within maximum length",
+			content:  "KEY=\"12345\"",
+			opts:     Options{MaxValueLength: 5},
+			expected: map[string]string{"KEY": "12345"},
+		},
+		{
+			name:    "value exceeds maximum length",
+			content: "KEY=123456",
+			opts:    Options{MaxValueLength: 5},
+			wantErr: ErrValueTooLong,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env, err := NewParserWithOptions(tc.content, tc.opts).Parse()
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Expected %v, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			for k, v := range tc.expected {
+				if env[k] != v {
+					t.Errorf("Expected %s=%q, got %s=%q", k, v, k, env[k])
+				}
+			}
+		})
+	}
+}
+
 func TestLoadFromReader(t *testing.T) {
 	content := "KEY1=value1\nKEY2=value2"
 	reader := strings.NewReader(content)
@@ -339,3 +968,368 @@ func TestLoadFromReader(t *testing.T) {
 		}
 	}
 }
+
+func TestSystemdWarnings(t *testing.T) {
+	content := "export EXPORTED=yes\n1BAD=value\nVALID=yes\n"
+
+	parser := NewParserWithOptions(content, Options{Dialect: DialectSystemd})
+	env, err := parser.Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(env) != 1 || env["VALID"] != "yes" {
+		t.Errorf("Expected only VALID=yes, got %v", env)
+	}
+
+	// Skipped lines are reported as warnings
+	warnings := parser.Warnings()
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+	if !errors.Is(warnings[0], ErrMissingAssign) || !errors.Is(warnings[1], ErrInvalidKey) {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+}
+
+func TestLineContinuation(t *testing.T) {
+	content := "HOSTS=alpha,\\\n" +
+		"beta,\\\r\n" +
+		"gamma # comment\n" +
+		"QUOTED=\"first \\\n" +
+		"second\"\n" +
+		"SINGLE='kept \\\n" +
+		"as is'\n" +
+		"NEXT=value\n"
+
+	entries, err := NewParserWithOptions(content, Options{LineContinuation: true}).ParseEntries()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Entry{
+		{Key: "HOSTS", Value: "alpha,beta,gamma", Line: 1},
+		{Key: "QUOTED", Value: "first second", Line: 4},
+		{Key: "SINGLE", Value: "kept \\\nas is", Line: 6},
+		{Key: "NEXT", Value: "value", Line: 8},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %v", len(expected), entries)
+	}
+	for i, want := range expected {
+		if entries[i].Key != want.Key || entries[i].Value != want.Value || entries[i].Line != want.Line {
+			t.Errorf("Entry %d: expected %s=%q at line %d, got %s=%q at line %d",
+				i, want.Key, want.Value, want.Line, entries[i].Key, entries[i].Value, entries[i].Line)
+		}
+	}
+
+	// Errors after a continued value report the line they occur on, and
+	// parsing resumes after it
+	content = "A=\"one \\\ntwo\" junk\nB=ok\n"
+	env, err := NewParserWithOptions(content, Options{LineContinuation: true}).ParseAll()
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 2 || !errors.Is(err, ErrTrailingText) {
+		t.Fatalf("Expected trailing text error on line 2, got %v", err)
+	}
+	if len(env) != 1 || env["B"] != "ok" {
+		t.Errorf("Expected only B=ok, got %v", env)
+	}
+
+	// With the whitespace rule, '#' starts a comment when whitespace
+	// precedes it in the joined value
+	opts := Options{LineContinuation: true, CommentNeedsSpace: true}
+	content = "A=one \\\n#two\nB=one\\\n#two\nC=\\\n#three\n"
+	env, err = NewParserWithOptions(content, opts).Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if env["A"] != "one" || env["B"] != "one#two" || env["C"] != "#three" {
+		t.Errorf("Unexpected comment handling after continuation: %v", env)
+	}
+
+	// Without the option a trailing backslash is part of the value
+	env, err = NewParser("PATH_DIR=C:\\dir\\\nNEXT=value\n").Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if env["PATH_DIR"] != "C:\\dir\\" || env["NEXT"] != "value" {
+		t.Errorf("Unexpected values without line continuation: %v", env)
+	}
+}
+
+func TestHeredocs(t *testing.T) {
+	content := "HOST=db\n" +
+		"CERT=<<EOF\n" +
+		"-----BEGIN CERTIFICATE-----\n" +
+		"MIIB \"quoted\" 'single'\n" +
+		"-----END CERTIFICATE-----\n" +
+		"EOF\n" +
+		"EXPANDED=<<END\n" +
+		"url=http://$HOST\n" +
+		"price=\\$5\n" +
+		"END\n" +
+		"LITERAL=<<'END'\n" +
+		"url=http://$HOST\\n\n" +
+		"END\n" +
+		"INDENTED=<<-END\n" +
+		"\t{\"a\": 1}\n" +
+		"\tEND\n" +
+		"NEXT=value\n"
+
+	entries, err := NewParserWithOptions(content, Options{Heredocs: true}).ParseEntries()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Entry{
+		{Key: "HOST", Value: "db", Line: 1},
+		{Key: "CERT", Value: "-----BEGIN CERTIFICATE-----\nMIIB \"quoted\" 'single'\n-----END CERTIFICATE-----", Line: 2},
+		{Key: "EXPANDED", Value: "url=http://db\nprice=$5", Line: 7},
+		{Key: "LITERAL", Value: "url=http://$HOST\\n", Line: 11},
+		{Key: "INDENTED", Value: "{\"a\": 1}", Line: 14},
+		{Key: "NEXT", Value: "value", Line: 17},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %v", len(expected), entries)
+	}
+	for i, want := range expected {
+		if entries[i].Key != want.Key || entries[i].Value != want.Value || entries[i].Line != want.Line {
+			t.Errorf("Entry %d: expected %s=%q at line %d, got %s=%q at line %d",
+				i, want.Key, want.Value, want.Line, entries[i].Key, entries[i].Value, entries[i].Line)
+		}
+		if i > 0 && i < 5 && entries[i].Quote != QuoteHeredoc {
+			t.Errorf("Entry %d: expected heredoc quote style, got %s", i, entries[i].Quote)
+		}
+	}
+
+	// A heredoc without its closing delimiter is an error at its start
+	_, err = NewParserWithOptions("A=1\nB=<<EOF\nnever closed\n", Options{Heredocs: true}).Parse()
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !errors.Is(err, ErrUnterminatedQuote) || parseErr.Line != 2 || parseErr.Col != 3 {
+		t.Errorf("Expected unterminated heredoc error at 2:3, got %v", err)
+	}
+
+	// Without the option "<<EOF" is an ordinary value
+	env, err := NewParser("A=<<EOF\n").Parse()
+	if err != nil || env["A"] != "<<EOF" {
+		t.Errorf("Expected A=<<EOF without heredocs, got %v, %v", env, err)
+	}
+}
+
+func TestBackticks(t *testing.T) {
+	content := "NAME=world\n" +
+		"MIXED=`it's \"quoted\"`\n" +
+		"MULTI=`hello $NAME\n" +
+		"no \\n escapes`\n"
+
+	env, err := NewParserWithOptions(content, Options{Backticks: true}).Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if env["MIXED"] != `it's "quoted"` {
+		t.Errorf("MIXED: expected %q, got %q", `it's "quoted"`, env["MIXED"])
+	}
+	if env["MULTI"] != "hello world\nno \\n escapes" {
+		t.Errorf("MULTI: expected %q, got %q", "hello world\nno \\n escapes", env["MULTI"])
+	}
+}
+
+func TestUnicodeEscapes(t *testing.T) {
+	content := `GREETING="grüß dich \U0001F600"
+COLOR="\e[31mred\x1b[0m"
+CONTROL="\0\a\b\f\v"
+LATIN="\x7e\u00ff"
+SINGLE='ü'`
+
+	env, err := NewParser(content).Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"GREETING": "grüß dich 😀",
+		"COLOR":    "\x1b[31mred\x1b[0m",
+		"CONTROL":  "\x00\a\b\f\v",
+		"LATIN":    "~ÿ",
+		"SINGLE":   `ü`,
+	}
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("Expected %s=%q, got %s=%q", k, v, k, env[k])
+		}
+	}
+
+	invalid := []struct {
+		content string
+		col     int
+	}{
+		{`A="\x4"`, 4},
+		{`A="\xff"`, 4}, // a lone byte above 0x7F is not valid UTF-8
+		{`A="ok \u12"`, 7},
+		{`A="\uD800"`, 4},
+		{`A="\U00110000"`, 4},
+		{`A="\Uzzzzzzzz"`, 4},
+	}
+	for _, tc := range invalid {
+		_, err := NewParser(tc.content).Parse()
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, ErrInvalidEscape) {
+			t.Errorf("%s: expected invalid escape error, got %v", tc.content, err)
+			continue
+		}
+		if parseErr.Kind != KindInvalidEscape || parseErr.Line != 1 || parseErr.Col != tc.col {
+			t.Errorf("%s: expected %s at 1:%d, got %s at %d:%d",
+				tc.content, KindInvalidEscape, tc.col, parseErr.Kind, parseErr.Line, parseErr.Col)
+		}
+	}
+}
+
+func TestBareKeys(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		values := map[string]string{"SHELL_PATH": "/usr/bin", "DEBUG": "1"}
+		value, ok := values[key]
+		return value, ok
+	}
+	content := "export SHELL_PATH\nDEBUG # from the environment\nexport NOT_SET\nBIN=$SHELL_PATH/app\n"
+
+	entries, err := NewParserWithOptions(content, Options{Lookup: lookup}).ParseEntries()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Entry{
+		{Key: "SHELL_PATH", Value: "/usr/bin", Kind: EntryPassthrough, Exported: true},
+		{Key: "DEBUG", Value: "1", Kind: EntryDeclaration},
+		{Key: "BIN", Value: "/usr/bin/app", Kind: EntryAssignment},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %v", len(expected), entries)
+	}
+	for i, want := range expected {
+		got := entries[i]
+		if got.Key != want.Key || got.Value != want.Value || got.Kind != want.Kind || got.Exported != want.Exported {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	// Without a lookup function the process environment is used
+	t.Setenv("DOTENV_BARE_KEY", "from os")
+	env, err := NewParser("DOTENV_BARE_KEY").Parse()
+	if err != nil || env["DOTENV_BARE_KEY"] != "from os" {
+		t.Errorf("Expected DOTENV_BARE_KEY from the environment, got %v, %v", env, err)
+	}
+
+	// Declared keys missing from the environment are all reported
+	_, err = NewParserWithOptions("FIRST\nOK=1\nSECOND", Options{Lookup: lookup}).Parse()
+	if !errors.Is(err, ErrMissingValue) || !strings.Contains(err.Error(), "FIRST") || !strings.Contains(err.Error(), "SECOND") {
+		t.Errorf("Expected missing value errors for FIRST and SECOND, got %v", err)
+	}
+
+	// Compose skips them like passthrough keys
+	env, err = NewParserWithOptions("FIRST\nOK=1", Options{Lookup: lookup, Dialect: DialectCompose}).Parse()
+	if err != nil || len(env) != 1 {
+		t.Errorf("Expected only OK with Compose, got %v, %v", env, err)
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	base := write("base.env", "# @include shared/common.env\nAPP=$HOST/app\nsource \"local.env\" # overrides\n")
+	common := write("shared/common.env", "HOST=db\nsource ../nested.env\n")
+	write("nested.env", "NESTED=yes\n")
+	write("local.env", "HOST=local\n")
+	opts := Options{Includes: true}
+
+	entries, err := LoadEntriesWithOptions(base, opts)
+	if err != nil {
+		t.Fatalf("LoadEntriesWithOptions failed: %v", err)
+	}
+	expected := []Entry{
+		{Key: "HOST", Value: "db", File: common},
+		{Key: "NESTED", Value: "yes", File: filepath.Join(dir, "nested.env")},
+		{Key: "APP", Value: "db/app", File: base},
+		{Key: "HOST", Value: "local", File: filepath.Join(dir, "local.env")},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %v", len(expected), entries)
+	}
+	for i, want := range expected {
+		got := entries[i]
+		if got.Key != want.Key || got.Value != want.Value || got.File != want.File {
+			t.Errorf("Entry %d: expected %s=%q from %s, got %s=%q from %s",
+				i, want.Key, want.Value, want.File, got.Key, got.Value, got.File)
+		}
+	}
+
+	// Errors in included files report the include chain, innermost first
+	top := write("top.env", "source mid.env\n")
+	mid := write("mid.env", "OK=1\nsource bad.env\n")
+	write("bad.env", "1BAD=value\n")
+	_, err = LoadWithOptions(top, opts)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Expected invalid key error, got %v", err)
+	}
+	chain := []IncludeStep{{Filename: mid, Line: 2}, {Filename: top, Line: 1}}
+	if parseErr.Filename != filepath.Join(dir, "bad.env") || !slices.Equal(parseErr.IncludeChain, chain) {
+		t.Errorf("Expected error in bad.env via %v, got %s via %v", chain, parseErr.Filename, parseErr.IncludeChain)
+	}
+	if !strings.HasSuffix(err.Error(), fmt.Sprintf("(included from %s:2, %s:1)", mid, top)) {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+
+	// Cycles are detected
+	cycle := write("a.env", "source b.env\n")
+	write("b.env", "source a.env\n")
+	if _, err := LoadWithOptions(cycle, opts); !errors.Is(err, ErrIncludeCycle) {
+		t.Errorf("Expected include cycle error, got %v", err)
+	}
+
+	// So is excessive nesting
+	for i := 0; i < 20; i++ {
+		write(fmt.Sprintf("deep%d.env", i), fmt.Sprintf("source deep%d.env\n", i+1))
+	}
+	write("deep20.env", "DEEP=1\n")
+	if _, err := LoadWithOptions(filepath.Join(dir, "deep0.env"), opts); !errors.Is(err, ErrIncludeDepth) {
+		t.Errorf("Expected include depth error, got %v", err)
+	}
+
+	// A missing file is an error at the directive
+	missing := write("missing.env", "A=1\n# @include nowhere.env\n")
+	_, err = LoadWithOptions(missing, opts)
+	if !errors.As(err, &parseErr) || !errors.Is(err, ErrInclude) || !errors.Is(err, fs.ErrNotExist) || parseErr.Line != 2 {
+		t.Errorf("Expected include error on line 2, got %v", err)
+	}
+
+	// Paths may reach parent and sibling directories, or be absolute
+	sibling := write("apps/web/.env", "# @include ../../shared/common.env\nsource "+filepath.Join(dir, "local.env")+"\n")
+	env, err := LoadWithOptions(sibling, opts)
+	if err != nil || env["HOST"] != "local" || env["NESTED"] != "yes" {
+		t.Errorf("Expected values from parent and absolute includes, got %v, %v", env, err)
+	}
+
+	// The default loaders treat directives as ordinary lines
+	env, err = Load(missing)
+	if err != nil || len(env) != 1 || env["A"] != "1" {
+		t.Errorf("Expected the directive to be a comment by default, got %v, %v", env, err)
+	}
+
+	// Directives are only recognized when includes are enabled
+	if _, err := NewParser("source other.env").Parse(); !errors.Is(err, ErrMissingAssign) {
+		t.Errorf("Expected source to be a plain key without includes, got %v", err)
+	}
+	env, err = NewParserWithOptions("source=value", Options{Includes: true}).Parse()
+	if err != nil || env["source"] != "value" {
+		t.Errorf("Expected source=value to be an assignment, got %v, %v", env, err)
+	}
+}
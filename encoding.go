@@ -0,0 +1,99 @@
+package dotenv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Byte order marks recognized at the start of input
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// decodeInput converts raw .env content to UTF-8 text with LF line endings.
+// It strips a UTF-8 byte order mark and transcodes UTF-16 input, which is
+// recognized by its byte order mark or, without one, by a zero byte in the
+// first character. Invalid input is reported as a ParseError giving the
+// byte offset of the first bad byte.
+func decodeInput(data []byte, filename string) (string, error) {
+	var text string
+	var err error
+
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		text, err = decodeUTF8(data[len(bomUTF8):], len(bomUTF8), filename)
+	case bytes.HasPrefix(data, bomUTF16LE):
+		text, err = decodeUTF16(data[len(bomUTF16LE):], len(bomUTF16LE), binary.LittleEndian, filename)
+	case bytes.HasPrefix(data, bomUTF16BE):
+		text, err = decodeUTF16(data[len(bomUTF16BE):], len(bomUTF16BE), binary.BigEndian, filename)
+	case len(data) >= 2 && data[0] == 0 && data[1] != 0:
+		text, err = decodeUTF16(data, 0, binary.BigEndian, filename)
+	case len(data) >= 2 && data[0] != 0 && data[1] == 0:
+		text, err = decodeUTF16(data, 0, binary.LittleEndian, filename)
+	default:
+		text, err = decodeUTF8(data, 0, filename)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ReplaceAll(text, "\r\n", "\n"), nil
+}
+
+// decodeUTF8 validates UTF-8 input found at byte offset base of the original data
+func decodeUTF8(data []byte, base int, filename string) (string, error) {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return "", encodingError(string(data[:i]), filename,
+				fmt.Errorf("%w: invalid UTF-8 at byte offset %d", ErrInvalidEncoding, base+i))
+		}
+		i += size
+	}
+	return string(data), nil
+}
+
+// decodeUTF16 transcodes UTF-16 input found at byte offset base of the
+// original data to UTF-8
+func decodeUTF16(data []byte, base int, order binary.ByteOrder, filename string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(data); i += 2 {
+		if i+1 >= len(data) {
+			return "", encodingError(b.String(), filename,
+				fmt.Errorf("%w: truncated UTF-16 at byte offset %d", ErrInvalidEncoding, base+i))
+		}
+
+		r := rune(order.Uint16(data[i:]))
+		if utf16.IsSurrogate(r) {
+			if i+3 < len(data) {
+				if pair := utf16.DecodeRune(r, rune(order.Uint16(data[i+2:]))); pair != utf8.RuneError {
+					b.WriteRune(pair)
+					i += 2
+					continue
+				}
+			}
+			return "", encodingError(b.String(), filename,
+				fmt.Errorf("%w: unpaired UTF-16 surrogate at byte offset %d", ErrInvalidEncoding, base+i))
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), nil
+}
+
+// encodingError builds a ParseError for invalid input that follows the
+// decoded text in prefix
+func encodingError(prefix, filename string, err error) *ParseError {
+	return &ParseError{
+		Filename: filename,
+		Line:     strings.Count(prefix, "\n") + 1,
+		Col:      len(prefix) - strings.LastIndexByte(prefix, '\n'),
+		Kind:     KindInvalidEncoding,
+		Err:      err,
+	}
+}
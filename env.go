@@ -1,19 +1,40 @@
 package dotenv
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"maps"
 	"os"
+	"slices"
 )
 
+// ModeVariable is the environment variable LoadMode reads the mode from
+// when none is given
+const ModeVariable = "APP_ENV"
+
 // Load loads environment variables from a .env file
 func Load(filename string) (map[string]string, error) {
+	return LoadWithOptions(filename, Options{})
+}
+
+// LoadWithOptions loads environment variables from a .env file using the
+// given options. opts.Filename is set to filename, so that errors name the
+// file and include directives resolve against its directory.
+func LoadWithOptions(filename string, opts Options) (map[string]string, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
 	}
 
-	parser := NewParser(string(data))
+	content, err := decodeInput(data, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Filename = filename
+	parser := NewParserWithOptions(content, opts)
 	return parser.Parse()
 }
 
@@ -24,10 +45,194 @@ func LoadFromReader(reader io.Reader) (map[string]string, error) {
 		return nil, fmt.Errorf("failed to read data: %w", err)
 	}
 
-	parser := NewParser(string(data))
+	content, err := decodeInput(data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	parser := NewParser(content)
 	return parser.Parse()
 }
 
+// LoadEntries loads the definitions from a .env file in declaration order
+func LoadEntries(filename string) ([]Entry, error) {
+	return LoadEntriesWithOptions(filename, Options{})
+}
+
+// LoadEntriesWithOptions loads the definitions from a .env file in
+// declaration order using the given options, like LoadWithOptions
+func LoadEntriesWithOptions(filename string, opts Options) ([]Entry, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+
+	content, err := decodeInput(data, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Filename = filename
+	parser := NewParserWithOptions(content, opts)
+	return parser.ParseEntries()
+}
+
+// LoadEntriesFromReader loads the definitions from an io.Reader in declaration order
+func LoadEntriesFromReader(reader io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+
+	content, err := decodeInput(data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	parser := NewParser(content)
+	return parser.ParseEntries()
+}
+
+// LoadResult is the outcome of loading several .env files
+type LoadResult struct {
+	Env    map[string]string // merged environment variables
+	Source map[string]string // key -> file that provided its value
+	Files  []string          // files that were read, in load order
+}
+
+// LoadFiles loads several .env files and merges them. Later files take
+// precedence over earlier ones, and their values may refer to keys defined
+// in earlier files. Every file must exist.
+func LoadFiles(files ...string) (*LoadResult, error) {
+	return loadFiles(nil, Options{}, files, false)
+}
+
+// LoadFilesWithOptions is like LoadFiles but parses every file using the
+// given options, with opts.Filename set to the file being parsed
+func LoadFilesWithOptions(opts Options, files ...string) (*LoadResult, error) {
+	return loadFiles(nil, opts, files, false)
+}
+
+// ModeFiles returns the conventional .env files for mode, from lowest to
+// highest precedence: .env, .env.local, .env.{mode} and .env.{mode}.local.
+// An empty mode gives only the first two.
+func ModeFiles(mode string) []string {
+	files := []string{".env", ".env.local"}
+	if mode != "" {
+		files = append(files, ".env."+mode, ".env."+mode+".local")
+	}
+	return files
+}
+
+// LoadMode loads the conventional .env files for mode from the working
+// directory, skipping the ones that do not exist. An empty mode is taken
+// from the ModeVariable environment variable.
+func LoadMode(mode string) (*LoadResult, error) {
+	if mode == "" {
+		mode = os.Getenv(ModeVariable)
+	}
+	return loadFiles(nil, Options{}, ModeFiles(mode), true)
+}
+
+// LoadFS loads and merges the .env files names from fsys, such as an
+// embed.FS, in the same way as LoadFiles. Without names it loads ".env".
+func LoadFS(fsys fs.FS, names ...string) (map[string]string, error) {
+	return LoadFSWithOptions(fsys, Options{}, names...)
+}
+
+// LoadFSWithOptions is like LoadFS but parses every file using the given
+// options. With opts.Includes, include directives are resolved inside fsys.
+func LoadFSWithOptions(fsys fs.FS, opts Options, names ...string) (map[string]string, error) {
+	if len(names) == 0 {
+		names = []string{".env"}
+	}
+	result, err := loadFiles(fsys, opts, names, false)
+	if err != nil {
+		return nil, err
+	}
+	return result.Env, nil
+}
+
+// LoadFilesFS is like LoadFiles but reads the files from fsys
+func LoadFilesFS(fsys fs.FS, names ...string) (*LoadResult, error) {
+	return loadFiles(fsys, Options{}, names, false)
+}
+
+// LoadModeFS is like LoadMode but reads the files from the root of fsys
+func LoadModeFS(fsys fs.FS, mode string) (*LoadResult, error) {
+	if mode == "" {
+		mode = os.Getenv(ModeVariable)
+	}
+	return loadFiles(fsys, Options{}, ModeFiles(mode), true)
+}
+
+// loadFiles loads and merges files in order from fsys, or from the OS
+// filesystem when fsys is nil, parsing each with opts. When optional is set,
+// files that do not exist are skipped.
+func loadFiles(fsys fs.FS, opts Options, files []string, optional bool) (*LoadResult, error) {
+	result := &LoadResult{
+		Env:    make(map[string]string),
+		Source: make(map[string]string),
+	}
+
+	for _, filename := range files {
+		data, err := readFile(fsys, filename)
+		if optional && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
+		}
+
+		content, err := decodeInput(data, filename)
+		if err != nil {
+			return nil, err
+		}
+
+		// Keys defined in earlier files are visible to later ones
+		fileOpts := opts
+		fileOpts.Filename = filename
+		parser := NewParserWithOptions(content, fileOpts)
+		parser.fsys = fsys
+		parser.earlier = result.Env
+		entries, env, errs := parser.parse()
+		if len(errs) > 0 {
+			return nil, firstError(errs)
+		}
+
+		sources := make(map[string]string)
+		for _, entry := range entries {
+			// A bare key repeating an earlier file's value does not take it over
+			if _, exists := result.Env[entry.Key]; exists && entry.Kind != EntryAssignment {
+				continue
+			}
+			sources[entry.Key] = entry.File
+		}
+		for key, value := range env {
+			source, defined := sources[key]
+			if !defined {
+				if _, exists := result.Env[key]; exists {
+					continue
+				}
+				source = filename // assigned by ${KEY:=word}
+			}
+			result.Env[key] = value
+			result.Source[key] = source
+		}
+		result.Files = append(result.Files, filename)
+	}
+
+	return result, nil
+}
+
+// readFile reads name from fsys, or from the OS filesystem when fsys is nil
+func readFile(fsys fs.FS, name string) ([]byte, error) {
+	if fsys != nil {
+		return fs.ReadFile(fsys, name)
+	}
+	return os.ReadFile(name)
+}
+
 // MustLoad loads environment variables and panics on error
 func MustLoad(filename string) map[string]string {
 	env, err := Load(filename)
@@ -37,21 +242,104 @@ func MustLoad(filename string) map[string]string {
 	return env
 }
 
-// Apply applies the environment variables to the current process
-func Apply(env map[string]string) error {
-	for key, value := range env {
-		if err := os.Setenv(key, value); err != nil {
-			return fmt.Errorf("failed to set environment variable %s: %w", key, err)
+// ApplyReport lists what applying environment variables did to each key,
+// in sorted order
+type ApplyReport struct {
+	Set         []string // keys that were not set before
+	Skipped     []string // keys that were already set and kept their value
+	Overwritten []string // keys that were already set and were replaced
+
+	previous []envChange // state before each change, in the order applied
+}
+
+// envChange records the state of a variable before it was changed
+type envChange struct {
+	key     string
+	value   string
+	existed bool
+}
+
+// Apply applies the environment variables to the current process. Keys that
+// are already set, even to an empty value, keep their value, so the
+// environment given by the platform wins over .env files. If a variable
+// cannot be set, the changes already made are undone.
+func Apply(env map[string]string) (*ApplyReport, error) {
+	return apply(env, false)
+}
+
+// Overload applies the environment variables to the current process,
+// replacing the values of keys that are already set. Like Apply, it either
+// sets every variable or none.
+func Overload(env map[string]string) (*ApplyReport, error) {
+	return apply(env, true)
+}
+
+// apply sets the variables of env in sorted key order. Keys that are already
+// set are replaced only when overwrite is set. On failure it rolls back.
+func apply(env map[string]string, overwrite bool) (*ApplyReport, error) {
+	report := &ApplyReport{}
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		previous, exists := os.LookupEnv(key)
+		if exists && !overwrite {
+			report.Skipped = append(report.Skipped, key)
+			continue
+		}
+		if err := os.Setenv(key, env[key]); err != nil {
+			err = fmt.Errorf("failed to set environment variable %s: %w", key, err)
+			if restoreErr := report.Restore(); restoreErr != nil {
+				err = errors.Join(err, restoreErr)
+			}
+			return nil, err
+		}
+		report.previous = append(report.previous, envChange{key: key, value: previous, existed: exists})
+		if exists {
+			report.Overwritten = append(report.Overwritten, key)
+		} else {
+			report.Set = append(report.Set, key)
 		}
 	}
-	return nil
+	return report, nil
 }
 
-// LoadAndApply loads and applies environment variables from a file
+// Restore undoes the changes made by the Apply or Overload call that
+// returned the report: replaced variables get their previous value back and
+// new ones are unset. Calling it again does nothing.
+func (r *ApplyReport) Restore() error {
+	var errs []error
+	for i := len(r.previous) - 1; i >= 0; i-- {
+		change := r.previous[i]
+		var err error
+		if change.existed {
+			err = os.Setenv(change.key, change.value)
+		} else {
+			err = os.Unsetenv(change.key)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore environment variable %s: %w", change.key, err))
+		}
+	}
+	r.previous = nil
+	return errors.Join(errs...)
+}
+
+// LoadAndApply loads and applies environment variables from a file, keeping
+// the values of keys that are already set
 func LoadAndApply(filename string) error {
 	env, err := Load(filename)
 	if err != nil {
 		return err
 	}
-	return Apply(env)
+	_, err = Apply(env)
+	return err
+}
+
+// LoadAndOverload loads and applies environment variables from a file,
+// replacing the values of keys that are already set
+func LoadAndOverload(filename string) error {
+	env, err := Load(filename)
+	if err != nil {
+		return err
+	}
+	_, err = Overload(env)
+	return err
 }
@@ -0,0 +1,224 @@
+package dotenv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors for the kinds of problems reported by ParseError.
+// Use errors.Is to test for them.
+var (
+	ErrUnterminatedQuote = errors.New("unterminated quoted string")
+	ErrInvalidKey        = errors.New("invalid key name")
+	ErrMissingAssign     = errors.New("expected '=' after variable name")
+	ErrTrailingText      = errors.New("unexpected text after value")
+	ErrUnsetVariable     = errors.New("required variable is unset or empty")
+	ErrReferenceCycle    = errors.New("variable reference cycle")
+	ErrDuplicateKey      = errors.New("duplicate key")
+	ErrInvalidWhitespace = errors.New("whitespace around '=' is not allowed")
+	ErrValueTooLong      = errors.New("value exceeds maximum length")
+	ErrInvalidEscape     = errors.New("invalid escape sequence")
+	ErrInvalidEncoding   = errors.New("invalid text encoding")
+	ErrMissingValue      = errors.New("declared variable is not set")
+	ErrInclude           = errors.New("cannot include file")
+	ErrIncludeCycle      = errors.New("include cycle")
+	ErrIncludeDepth      = errors.New("includes nested too deeply")
+)
+
+// ErrorKind classifies a ParseError
+type ErrorKind int
+
+const (
+	KindUnterminatedQuote ErrorKind = iota
+	KindInvalidKey
+	KindMissingAssign
+	KindUnsetVariable
+	KindReferenceCycle
+	KindTrailingText
+	KindDuplicateKey
+	KindInvalidWhitespace
+	KindValueTooLong
+	KindInvalidEscape
+	KindInvalidEncoding
+	KindMissingValue
+	KindInclude
+	KindIncludeCycle
+	KindIncludeDepth
+)
+
+// String returns a machine-readable name for the error kind
+func (k ErrorKind) String() string {
+	switch k {
+	case KindUnterminatedQuote:
+		return "unterminated_quote"
+	case KindInvalidKey:
+		return "invalid_key"
+	case KindMissingAssign:
+		return "missing_assign"
+	case KindUnsetVariable:
+		return "unset_variable"
+	case KindReferenceCycle:
+		return "reference_cycle"
+	case KindTrailingText:
+		return "trailing_text"
+	case KindDuplicateKey:
+		return "duplicate_key"
+	case KindInvalidWhitespace:
+		return "invalid_whitespace"
+	case KindValueTooLong:
+		return "value_too_long"
+	case KindInvalidEscape:
+		return "invalid_escape"
+	case KindInvalidEncoding:
+		return "invalid_encoding"
+	case KindMissingValue:
+		return "missing_value"
+	case KindInclude:
+		return "include"
+	case KindIncludeCycle:
+		return "include_cycle"
+	case KindIncludeDepth:
+		return "include_depth"
+	default:
+		return "unknown"
+	}
+}
+
+// sentinel returns the sentinel error matching the error kind
+func (k ErrorKind) sentinel() error {
+	switch k {
+	case KindUnterminatedQuote:
+		return ErrUnterminatedQuote
+	case KindInvalidKey:
+		return ErrInvalidKey
+	case KindMissingAssign:
+		return ErrMissingAssign
+	case KindUnsetVariable:
+		return ErrUnsetVariable
+	case KindReferenceCycle:
+		return ErrReferenceCycle
+	case KindTrailingText:
+		return ErrTrailingText
+	case KindDuplicateKey:
+		return ErrDuplicateKey
+	case KindInvalidWhitespace:
+		return ErrInvalidWhitespace
+	case KindValueTooLong:
+		return ErrValueTooLong
+	case KindInvalidEscape:
+		return ErrInvalidEscape
+	case KindInvalidEncoding:
+		return ErrInvalidEncoding
+	case KindMissingValue:
+		return ErrMissingValue
+	case KindInclude:
+		return ErrInclude
+	case KindIncludeCycle:
+		return ErrIncludeCycle
+	case KindIncludeDepth:
+		return ErrIncludeDepth
+	default:
+		return nil
+	}
+}
+
+// ParseError describes a problem found while parsing .env content
+type ParseError struct {
+	Filename string    // file being parsed, empty when parsing a string or reader
+	Line     int       // 1-based line of the problem
+	Col      int       // 1-based byte column of the problem
+	Key      string    // key of the entry, empty if it could not be parsed
+	Kind     ErrorKind // machine-readable classification
+	Source   string    // the offending source line, without its newline
+	Err      error     // the underlying error
+
+	// IncludeChain lists the include directives through which Filename was
+	// reached, innermost first. It is empty for the file being parsed.
+	IncludeChain []IncludeStep
+}
+
+// IncludeStep is the location of an include directive
+type IncludeStep struct {
+	Filename string // file containing the directive, empty when parsing a string or reader
+	Line     int    // 1-based line of the directive
+}
+
+// Error returns the error message prefixed with its location
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	if e.Filename != "" {
+		fmt.Fprintf(&b, "%s:%d:%d: ", e.Filename, e.Line, e.Col)
+	} else {
+		fmt.Fprintf(&b, "line %d, column %d: ", e.Line, e.Col)
+	}
+	if e.Key != "" {
+		b.WriteString(e.Key)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Err.Error())
+
+	for i, step := range e.IncludeChain {
+		if i == 0 {
+			b.WriteString(" (included from ")
+		} else {
+			b.WriteString(", ")
+		}
+		if step.Filename != "" {
+			fmt.Fprintf(&b, "%s:%d", step.Filename, step.Line)
+		} else {
+			fmt.Fprintf(&b, "line %d", step.Line)
+		}
+	}
+	if len(e.IncludeChain) > 0 {
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel error for the error's kind
+func (e *ParseError) Is(target error) bool {
+	return target != nil && target == e.Kind.sentinel()
+}
+
+// Snippet returns the offending source line followed by a caret under the
+// error column, suitable for compiler-style diagnostics
+func (e *ParseError) Snippet() string {
+	if e.Source == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(e.Source)
+	b.WriteByte('\n')
+	for i := 0; i < e.Col-1 && i < len(e.Source); i++ {
+		// Keep tabs so the caret lines up in terminals
+		if e.Source[i] == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	return b.String()
+}
+
+// sourceLine returns the line of content containing the byte offset pos
+func sourceLine(content string, pos int) string {
+	if pos > len(content) {
+		pos = len(content)
+	}
+	start := strings.LastIndexByte(content[:pos], '\n') + 1
+	end := strings.IndexByte(content[pos:], '\n')
+	if end < 0 {
+		end = len(content)
+	} else {
+		end += pos
+	}
+	return strings.TrimSuffix(content[start:end], "\r")
+}
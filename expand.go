@@ -0,0 +1,346 @@
+package dotenv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// expander performs variable expansion over a single value
+type expander struct {
+	src      string
+	literals []int // offsets of dollar signs that must not be expanded
+	env      map[string]string
+	opts     Options
+}
+
+// expandVariables expands $VAR, ${VAR} and the POSIX parameter expansion
+// forms ${VAR:-word}, ${VAR-word}, ${VAR:=word}, ${VAR=word}, ${VAR:?word},
+// ${VAR?word}, ${VAR:+word} and ${VAR+word} in the value.
+// Variables are resolved against env and then opts.Lookup, in the order
+// chosen by opts.PreferLookup. Plain references to unknown variables are
+// kept as literal text, or dropped in the Compose dialect. Dollar signs at
+// the offsets in literals are never expanded.
+func expandVariables(value string, literals []int, env map[string]string, opts Options) (string, error) {
+	e := &expander{src: value, literals: literals, env: env, opts: opts}
+	return e.expand(0, len(value))
+}
+
+// isLiteral reports whether the dollar sign at offset i was escaped
+func isLiteral(literals []int, i int) bool {
+	for _, offset := range literals {
+		if offset == i {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve looks up a variable in the parsed values and the lookup function
+func (e *expander) resolve(name string) (string, bool) {
+	lookup := e.opts.Lookup
+	if lookup != nil && e.opts.PreferLookup {
+		if val, exists := lookup(name); exists {
+			return val, true
+		}
+	}
+	if val, exists := e.env[name]; exists {
+		return val, true
+	}
+	if lookup != nil && !e.opts.PreferLookup {
+		return lookup(name)
+	}
+	return "", false
+}
+
+// writeUnresolved writes a reference to an unknown variable. It is kept as
+// is, except in the Compose dialect where it expands to an empty string.
+func (e *expander) writeUnresolved(result *strings.Builder, reference string) {
+	if e.opts.Dialect != DialectCompose {
+		result.WriteString(reference)
+	}
+}
+
+// expand expands the region src[start:end]
+func (e *expander) expand(start, end int) (string, error) {
+	var result strings.Builder
+
+	for i := start; i < end; {
+		ch := e.src[i]
+		if ch != '$' || i+1 >= end || isLiteral(e.literals, i) {
+			result.WriteByte(ch)
+			i++
+			continue
+		}
+
+		next := e.src[i+1]
+		switch {
+		case next == '{':
+			n, err := e.expandBraced(i, end, &result)
+			if err != nil {
+				return "", err
+			}
+			i = n
+		case isValidKeyStart(next):
+			j := i + 1
+			for j < end && isValidKeyChar(e.src[j]) {
+				j++
+			}
+			if val, exists := e.resolve(e.src[i+1 : j]); exists {
+				result.WriteString(val)
+			} else {
+				e.writeUnresolved(&result, e.src[i:j])
+			}
+			i = j
+		default:
+			result.WriteByte(ch)
+			i++
+		}
+	}
+
+	return result.String(), nil
+}
+
+// expandBraced expands the ${...} reference starting at src[start] and
+// returns the position just past the closing brace
+func (e *expander) expandBraced(start, end int, result *strings.Builder) (int, error) {
+	i := start + 2 // skip "${"
+	if i >= end || !isValidKeyStart(e.src[i]) {
+		result.WriteString("${")
+		return i, nil
+	}
+
+	nameStart := i
+	for i < end && isValidKeyChar(e.src[i]) {
+		i++
+	}
+	name := e.src[nameStart:i]
+
+	closing := e.findClosingBrace(i, end)
+	if closing < 0 {
+		// No closing brace, keep the text as is
+		result.WriteString(e.src[start:i])
+		return i, nil
+	}
+
+	val, exists := e.resolve(name)
+
+	if i == closing {
+		if exists {
+			result.WriteString(val)
+		} else {
+			e.writeUnresolved(result, e.src[start:closing+1])
+		}
+		return closing + 1, nil
+	}
+
+	// Parse the operator: an optional ':' followed by one of - = ? +
+	colon := false
+	if e.src[i] == ':' {
+		colon = true
+		i++
+	}
+	if i >= closing || !strings.ContainsRune("-=?+", rune(e.src[i])) {
+		// Not an expansion we understand, keep the text as is
+		result.WriteString(e.src[start : closing+1])
+		return closing + 1, nil
+	}
+	op := e.src[i]
+	wordStart := i + 1
+
+	// With ':' an empty value counts as unset, as in POSIX shells
+	useWord := !exists || (colon && val == "")
+
+	switch op {
+	case '-':
+		if !useWord {
+			result.WriteString(val)
+			break
+		}
+		word, err := e.expand(wordStart, closing)
+		if err != nil {
+			return 0, err
+		}
+		result.WriteString(word)
+
+	case '=':
+		if !useWord {
+			result.WriteString(val)
+			break
+		}
+		word, err := e.expand(wordStart, closing)
+		if err != nil {
+			return 0, err
+		}
+		e.env[name] = word
+		result.WriteString(word)
+
+	case '?':
+		if !useWord {
+			result.WriteString(val)
+			break
+		}
+		message, err := e.expand(wordStart, closing)
+		if err != nil {
+			return 0, err
+		}
+		if e.opts.Dialect == DialectCompose {
+			if message == "" {
+				return 0, fmt.Errorf("required variable %s is missing a value", name)
+			}
+			return 0, fmt.Errorf("required variable %s is missing a value: %s", name, message)
+		}
+		if message == "" {
+			message = "parameter null or not set"
+		}
+		return 0, fmt.Errorf("%s: %s", name, message)
+
+	case '+':
+		if useWord {
+			break
+		}
+		word, err := e.expand(wordStart, closing)
+		if err != nil {
+			return 0, err
+		}
+		result.WriteString(word)
+	}
+
+	return closing + 1, nil
+}
+
+// findClosingBrace returns the index of the '}' that closes a ${ opened
+// before pos, skipping over nested ${...} references, or -1 if there is none
+func (e *expander) findClosingBrace(pos, end int) int {
+	depth := 0
+	for i := pos; i < end; i++ {
+		switch e.src[i] {
+		case '$':
+			if i+1 < end && e.src[i+1] == '{' && !isLiteral(e.literals, i) {
+				depth++
+				i++
+			}
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// variableRefs returns the names of the variables referenced in value,
+// including references nested inside expansion words
+func variableRefs(value string, literals []int) []string {
+	var refs []string
+	for i := 0; i+1 < len(value); i++ {
+		if value[i] != '$' || isLiteral(literals, i) {
+			continue
+		}
+		start := i + 1
+		if value[start] == '{' {
+			start++
+		}
+		if start >= len(value) || !isValidKeyStart(value[start]) {
+			continue
+		}
+		end := start
+		for end < len(value) && isValidKeyChar(value[end]) {
+			end++
+		}
+		refs = append(refs, value[start:end])
+		i = end - 1
+	}
+	return refs
+}
+
+// expansionOrder returns the indexes of results in an order where every
+// entry comes after the entries it references. Only the last definition of
+// each key takes part; index maps each key to that definition. Self
+// references are left to the lookup function rather than treated as cycles.
+// Entries caught in a cycle are left out of the order and every cycle is
+// reported.
+func expansionOrder(results []LineResult, index map[string]int) ([]int, []error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(results))
+	order := make([]int, 0, len(index))
+	var path []int
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return cycleError(results, path, i)
+		}
+
+		state[i] = visiting
+		path = append(path, i)
+
+		if results[i].AllowExpansion {
+			for _, ref := range variableRefs(results[i].Value, results[i].literals) {
+				j, defined := index[ref]
+				if !defined || j == i {
+					continue
+				}
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[i] = visited
+		order = append(order, i)
+		return nil
+	}
+
+	var errs []error
+	for i := range results {
+		if index[results[i].Key] != i {
+			continue // superseded by a later definition
+		}
+		if err := visit(i); err != nil {
+			errs = append(errs, err)
+
+			// Skip the entries on the failed path
+			for _, j := range path {
+				state[j] = visited
+			}
+			path = path[:0]
+		}
+	}
+
+	return order, errs
+}
+
+// cycleError describes the reference cycle that closes at results[i]
+func cycleError(results []LineResult, path []int, i int) error {
+	start := 0
+	for k, j := range path {
+		if j == i {
+			start = k
+			break
+		}
+	}
+
+	var steps []string
+	for _, j := range path[start:] {
+		steps = append(steps, fmt.Sprintf("%s (line %d)", results[j].Key, results[j].Line))
+	}
+	steps = append(steps, results[i].Key)
+
+	return &ParseError{
+		Line: results[i].Line,
+		Col:  results[i].col,
+		Key:  results[i].Key,
+		Kind: KindReferenceCycle,
+		Err:  fmt.Errorf("%w: %s", ErrReferenceCycle, strings.Join(steps, " -> ")),
+	}
+}
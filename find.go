@@ -0,0 +1,104 @@
+package dotenv
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// boundaryMarkers are the entries that mark the root of a project. Find does
+// not look above a directory containing one of them.
+var boundaryMarkers = []string{"go.mod", ".git"}
+
+// Find looks for the file name in the working directory and its parents and
+// returns the path of the nearest one. The search stops at the first
+// directory that contains a go.mod file or a .git directory, or at the root
+// of the filesystem.
+func Find(name string) (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return find(nil, dir, name)
+}
+
+// FindFS is like Find but searches fsys, starting at the slash-separated
+// directory dir and stopping at the root of fsys
+func FindFS(fsys fs.FS, dir, name string) (string, error) {
+	return find(fsys, path.Clean(dir), name)
+}
+
+// find searches dir and its parents in fsys, or in the OS filesystem when
+// fsys is nil, for the file name
+func find(fsys fs.FS, dir, name string) (string, error) {
+	join, parentOf := filepath.Join, filepath.Dir
+	if fsys != nil {
+		join, parentOf = path.Join, path.Dir
+	}
+	start := dir
+
+	for {
+		file := join(dir, name)
+		if info, err := stat(fsys, file); err == nil && !info.IsDir() {
+			return file, nil
+		}
+		if isBoundary(fsys, dir, join) {
+			break
+		}
+		parent := parentOf(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return "", fmt.Errorf("%s not found in %s or its parents: %w", name, start, fs.ErrNotExist)
+}
+
+// isBoundary reports whether dir is the root of a project
+func isBoundary(fsys fs.FS, dir string, join func(...string) string) bool {
+	for _, marker := range boundaryMarkers {
+		if _, err := stat(fsys, join(dir, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// stat describes name in fsys, or in the OS filesystem when fsys is nil
+func stat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys != nil {
+		return fs.Stat(fsys, name)
+	}
+	return os.Stat(name)
+}
+
+// LoadNearest loads the nearest file name found by Find and returns the
+// environment variables together with its path
+func LoadNearest(name string) (map[string]string, string, error) {
+	file, err := Find(name)
+	if err != nil {
+		return nil, "", err
+	}
+	env, err := Load(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return env, file, nil
+}
+
+// LoadNearestFS is like LoadNearest but searches and loads from fsys,
+// starting at the slash-separated directory dir
+func LoadNearestFS(fsys fs.FS, dir, name string) (map[string]string, string, error) {
+	file, err := FindFS(fsys, dir, name)
+	if err != nil {
+		return nil, "", err
+	}
+	env, err := LoadFS(fsys, file)
+	if err != nil {
+		return nil, "", err
+	}
+	return env, file, nil
+}
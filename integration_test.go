@@ -1,8 +1,18 @@
 package dotenv
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"unicode/utf16"
 )
 
 func TestIntegration(t *testing.T) {
@@ -116,3 +126,254 @@ MULTILINE_TEXT="Line 1\nLine 2\tTabbed\nLine 3"
 
 	t.Logf("Integration test passed! Parsed %d environment variables", len(env))
 }
+
+func TestLoadEncodings(t *testing.T) {
+	content := "GREETING=\"grüß\r\ndich\"\r\nNAME=app\r\n"
+	expected := map[string]string{"GREETING": "grüß\ndich", "NAME": "app"}
+
+	utf16Bytes := func(order binary.AppendByteOrder, bom bool) []byte {
+		var data []byte
+		if bom {
+			data = order.AppendUint16(data, 0xFEFF)
+		}
+		for _, unit := range utf16.Encode([]rune(content)) {
+			data = order.AppendUint16(data, unit)
+		}
+		return data
+	}
+
+	inputs := map[string][]byte{
+		"utf-8":         []byte(content),
+		"utf-8 bom":     append([]byte{0xEF, 0xBB, 0xBF}, content...),
+		"utf-16le bom":  utf16Bytes(binary.LittleEndian, true),
+		"utf-16be bom":  utf16Bytes(binary.BigEndian, true),
+		"utf-16le bare": utf16Bytes(binary.LittleEndian, false),
+		"utf-16be bare": utf16Bytes(binary.BigEndian, false),
+	}
+	for name, data := range inputs {
+		env, err := LoadFromReader(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: LoadFromReader failed: %v", name, err)
+			continue
+		}
+		for k, v := range expected {
+			if env[k] != v {
+				t.Errorf("%s: expected %s=%q, got %q", name, k, v, env[k])
+			}
+		}
+	}
+
+	// Invalid UTF-8 is reported with its byte offset
+	filename := filepath.Join(t.TempDir(), "bad.env")
+	if err := os.WriteFile(filename, []byte("A=1\nB=caf\xe9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(filename)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !errors.Is(err, ErrInvalidEncoding) {
+		t.Fatalf("Expected invalid encoding error, got %v", err)
+	}
+	if parseErr.Line != 2 || parseErr.Col != 6 || !strings.Contains(err.Error(), "byte offset 9") {
+		t.Errorf("Unexpected error location: %v", err)
+	}
+
+	// So is an unpaired UTF-16 surrogate
+	bad := binary.LittleEndian.AppendUint16([]byte{0xFF, 0xFE, 'A', 0, '=', 0}, 0xD800)
+	if _, err := LoadFromReader(bytes.NewReader(bad)); !errors.Is(err, ErrInvalidEncoding) ||
+		!strings.Contains(err.Error(), "byte offset 6") {
+		t.Errorf("Expected unpaired surrogate error at byte offset 6, got %v", err)
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.env")
+	override := filepath.Join(dir, "override.env")
+	os.WriteFile(base, []byte("HOST=db\nPORT=5432\nNAME=app\n"), 0644)
+	os.WriteFile(override, []byte("PORT=6543\nURL=postgres://$HOST:$PORT/${NAME}\nCACHE=${CACHE:=redis}\n"), 0644)
+
+	result, err := LoadFiles(base, override)
+	if err != nil {
+		t.Fatalf("LoadFiles failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"HOST":  "db",
+		"PORT":  "6543",
+		"NAME":  "app",
+		"URL":   "postgres://db:6543/app",
+		"CACHE": "redis",
+	}
+	sources := map[string]string{
+		"HOST":  base,
+		"PORT":  override,
+		"NAME":  base,
+		"URL":   override,
+		"CACHE": override,
+	}
+	for key, want := range expected {
+		if result.Env[key] != want {
+			t.Errorf("Expected %s=%q, got %q", key, want, result.Env[key])
+		}
+		if result.Source[key] != sources[key] {
+			t.Errorf("Expected %s from %s, got %s", key, sources[key], result.Source[key])
+		}
+	}
+	if len(result.Env) != len(expected) {
+		t.Errorf("Expected %d keys, got %v", len(expected), result.Env)
+	}
+
+	// A single file gives the same result as Load
+	t.Setenv("LOADFILES_FROM_OS", "os")
+	single := filepath.Join(dir, "single.env")
+	os.WriteFile(single, []byte("A=$LOADFILES_FROM_OS\nB=${LOADFILES_FROM_OS:-unset}\nexport LOADFILES_FROM_OS\n"), 0644)
+	loaded, err := Load(single)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	result, err = LoadFiles(single)
+	if err != nil {
+		t.Fatalf("LoadFiles failed: %v", err)
+	}
+	if !maps.Equal(result.Env, loaded) || loaded["A"] != "$LOADFILES_FROM_OS" || loaded["B"] != "unset" {
+		t.Errorf("Expected LoadFiles to match Load, got %v and %v", result.Env, loaded)
+	}
+
+	required := filepath.Join(dir, "required.env")
+	os.WriteFile(required, []byte("A=${LOADFILES_FROM_OS:?must be set}\n"), 0644)
+	if _, err := Load(required); !errors.Is(err, ErrUnsetVariable) {
+		t.Errorf("Expected Load to fail, got %v", err)
+	}
+	if _, err := LoadFiles(required); !errors.Is(err, ErrUnsetVariable) {
+		t.Errorf("Expected LoadFiles to fail like Load, got %v", err)
+	}
+
+	// Explicitly listed files must exist
+	if _, err := LoadFiles(base, filepath.Join(dir, "missing.env")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+}
+
+func TestLoadMode(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.WriteFile(".env", []byte("A=env\nB=env\nC=env\nD=env\n"), 0644)
+	os.WriteFile(".env.local", []byte("B=local\nC=local\nD=local\n"), 0644)
+	os.WriteFile(".env.production", []byte("C=production\nD=production\n"), 0644)
+	os.WriteFile(".env.production.local", []byte("D=production.local\nexport A\n"), 0644)
+
+	t.Setenv(ModeVariable, "production")
+	result, err := LoadMode("")
+	if err != nil {
+		t.Fatalf("LoadMode failed: %v", err)
+	}
+
+	// A bare key does not take over the value of an earlier file
+	expected := map[string]string{"A": "env", "B": "local", "C": "production", "D": "production.local"}
+	sources := map[string]string{"A": ".env", "B": ".env.local", "C": ".env.production", "D": ".env.production.local"}
+	for key, want := range expected {
+		if result.Env[key] != want {
+			t.Errorf("Expected %s=%q, got %q", key, want, result.Env[key])
+		}
+		if result.Source[key] != sources[key] {
+			t.Errorf("Expected %s from %s, got %s", key, sources[key], result.Source[key])
+		}
+	}
+	if !slices.Equal(result.Files, ModeFiles("production")) {
+		t.Errorf("Expected all mode files to be read, got %v", result.Files)
+	}
+
+	// Missing files are skipped
+	result, err = LoadMode("staging")
+	if err != nil {
+		t.Fatalf("LoadMode failed: %v", err)
+	}
+	if result.Env["D"] != "local" || !slices.Equal(result.Files, []string{".env", ".env.local"}) {
+		t.Errorf("Expected only the base files, got %v from %v", result.Env, result.Files)
+	}
+}
+
+func TestFind(t *testing.T) {
+	// Resolve symlinks so paths match the working directory
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	module := filepath.Join(root, "module")
+	nested := filepath.Join(module, "internal", "pkg")
+	os.MkdirAll(nested, 0755)
+	os.WriteFile(filepath.Join(module, "go.mod"), []byte("module example.com/app\n"), 0644)
+	os.WriteFile(filepath.Join(module, ".env"), []byte("APP=module\n"), 0644)
+	os.WriteFile(filepath.Join(root, ".env.outside"), []byte("APP=outside\n"), 0644)
+	t.Chdir(nested)
+
+	env, path, err := LoadNearest(".env")
+	if err != nil {
+		t.Fatalf("LoadNearest failed: %v", err)
+	}
+	if path != filepath.Join(module, ".env") || env["APP"] != "module" {
+		t.Errorf("Expected APP=module from %s, got %v from %s", filepath.Join(module, ".env"), env, path)
+	}
+
+	// A closer file wins
+	os.WriteFile(filepath.Join(nested, ".env"), []byte("APP=nested\n"), 0644)
+	if path, err := Find(".env"); err != nil || path != filepath.Join(nested, ".env") {
+		t.Errorf("Expected the nested file, got %s, %v", path, err)
+	}
+
+	// The search stops at the module root
+	if _, err := Find(".env.outside"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		".env":                  {Data: []byte("HOST=db\n# @include config/common.env\n")},
+		".env.production":       {Data: []byte("HOST=prod-db\n")},
+		"config/common.env":     {Data: []byte("source ../shared/urls.env\nPORT=5432\n")},
+		"shared/urls.env":       {Data: []byte("URL=postgres://$HOST\n")},
+		"services/api/go.mod":   {Data: []byte("module example.com/api\n")},
+		"services/api/.env":     {Data: []byte("SERVICE=api\n")},
+		"services/api/cmd/main": {Data: []byte("")},
+	}
+
+	// Includes resolve inside the filesystem
+	opts := Options{Includes: true}
+	env, err := LoadFSWithOptions(fsys, opts)
+	if err != nil {
+		t.Fatalf("LoadFSWithOptions failed: %v", err)
+	}
+	if env["URL"] != "postgres://db" || env["PORT"] != "5432" {
+		t.Errorf("Expected included values, got %v", env)
+	}
+
+	result, err := LoadModeFS(fsys, "production")
+	if err != nil {
+		t.Fatalf("LoadModeFS failed: %v", err)
+	}
+	if result.Env["HOST"] != "prod-db" || result.Source["HOST"] != ".env.production" {
+		t.Errorf("Expected production values, got %v from %v", result.Env, result.Source)
+	}
+
+	// Includes may not leave the filesystem
+	for _, directive := range []string{"source ../outside.env", "source /etc/hostname", "# @include shared/../../outside.env"} {
+		fsys["escape.env"] = &fstest.MapFile{Data: []byte(directive + "\n")}
+		_, err := LoadFSWithOptions(fsys, opts, "escape.env")
+		if !errors.Is(err, ErrInclude) || errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: expected include error, got %v", directive, err)
+		}
+	}
+
+	// The nearest search stops at the module root
+	env, file, err := LoadNearestFS(fsys, "services/api/cmd", ".env")
+	if err != nil || file != "services/api/.env" || env["SERVICE"] != "api" {
+		t.Errorf("Expected services/api/.env, got %v from %s: %v", env, file, err)
+	}
+	if file, err := FindFS(fsys, "services/api/cmd", ".env.production"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected not exist error, got %s, %v", file, err)
+	}
+	if file, err := FindFS(fsys, "config", ".env.production"); err != nil || file != ".env.production" {
+		t.Errorf("Expected .env.production at the root, got %s, %v", file, err)
+	}
+}
@@ -0,0 +1,132 @@
+package dotenv
+
+// LookupFunc resolves the value of a variable by name
+type LookupFunc func(key string) (string, bool)
+
+// ExpansionMode controls when variable references in values are expanded
+type ExpansionMode int
+
+const (
+	// ExpandSequential expands each value as it is read, so references
+	// only resolve against keys defined earlier in the file
+	ExpandSequential ExpansionMode = iota
+	// ExpandDeferred parses every entry first and then expands values in
+	// dependency order, so references may point to keys defined later
+	ExpandDeferred
+	// ExpandNone leaves variable references in values as literal text
+	ExpandNone
+)
+
+// DuplicatePolicy controls what happens when a key is defined more than once
+type DuplicatePolicy int
+
+const (
+	// DuplicateLastWins keeps the value of the last definition
+	DuplicateLastWins DuplicatePolicy = iota
+	// DuplicateFirstWins keeps the value of the first definition
+	DuplicateFirstWins
+	// DuplicateError makes parsing fail at the second definition
+	DuplicateError
+)
+
+// Dialect selects a set of grammar rules matching another tool's .env format
+type Dialect int
+
+const (
+	// DialectDefault is the grammar of this package
+	DialectDefault Dialect = iota
+	// DialectCompose follows the env_file rules of Docker Compose: "$$" is a
+	// literal dollar sign, '#' starts an inline comment in an unquoted value
+	// only after a space, keys may contain '.' and '-', a backslash keeps a
+	// single quote from closing a single-quoted value, and references to
+	// unknown variables expand to an empty string
+	DialectCompose
+	// DialectSystemd follows the EnvironmentFile rules of systemd: lines
+	// starting with '#' or ';' are comments, there is no export keyword or
+	// variable expansion, values have no inline comments, a backslash
+	// escapes the next character or continues an unquoted value on the next
+	// line, and quoted and unquoted parts of a value are joined. Lines with
+	// an invalid key are skipped and reported by Parser.Warnings.
+	DialectSystemd
+)
+
+// Options configures the behavior of a Parser
+type Options struct {
+	// Filename is reported in parse errors
+	Filename string
+
+	// Dialect selects the grammar rules. Its rules are applied on top of
+	// the grammar switches below.
+	Dialect Dialect
+
+	// Lookup resolves variable references that are not defined earlier in
+	// the file. Use os.LookupEnv to fall back to the process environment.
+	Lookup LookupFunc
+
+	// PreferLookup makes values returned by Lookup win over values defined
+	// in the file when a reference could be resolved from both
+	PreferLookup bool
+
+	// Expansion selects when variable references are expanded
+	Expansion ExpansionMode
+
+	// Duplicates selects which definition wins when a key is defined more
+	// than once. Unless it is DuplicateError, duplicates are reported as
+	// warnings by Parser.Warnings.
+	Duplicates DuplicatePolicy
+
+	// DisableExport turns off support for the "export KEY=value" prefix
+	DisableExport bool
+
+	// AllowDotsInKeys and AllowDashesInKeys accept '.' and '-' in key names
+	// after the first character
+	AllowDotsInKeys   bool
+	AllowDashesInKeys bool
+
+	// CommentNeedsSpace makes '#' start an inline comment in an unquoted
+	// value only when it follows whitespace, so URL=https://host/#anchor
+	// keeps its fragment
+	CommentNeedsSpace bool
+
+	// StrictAssign rejects whitespace around '=' instead of skipping it
+	StrictAssign bool
+
+	// LineContinuation joins a line ending in a backslash with the next one
+	// in unquoted and double-quoted values, as shells do. The backslash and
+	// the line break are removed. An unquoted value can then no longer end
+	// in a literal backslash.
+	LineContinuation bool
+
+	// Heredocs accepts multiline values written as KEY=<<EOF, followed by
+	// lines up to one holding only the delimiter. As in shells, a quoted
+	// delimiter (<<'EOF' or <<"EOF") turns off expansion and escapes, and
+	// <<-EOF strips leading tabs from each line.
+	Heredocs bool
+
+	// Backticks accepts values quoted with '`'. They may span lines and
+	// contain both kinds of quotes; escapes are not processed, but
+	// variables are expanded.
+	Backticks bool
+
+	// Includes enables the "# @include path" and "source path" directives,
+	// which insert the definitions of another file at that point. Relative
+	// paths are resolved against the directory of Filename.
+	Includes bool
+
+	// MaxValueLength limits the length of a value in bytes, or is 0 for no limit
+	MaxValueLength int
+}
+
+// withDialect returns the options with the grammar rules of the dialect applied
+func (o Options) withDialect() Options {
+	switch o.Dialect {
+	case DialectCompose:
+		o.CommentNeedsSpace = true
+		o.AllowDotsInKeys = true
+		o.AllowDashesInKeys = true
+	case DialectSystemd:
+		o.DisableExport = true
+		o.Expansion = ExpandNone
+	}
+	return o
+}
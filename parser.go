@@ -1,22 +1,88 @@
 package dotenv
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strings"
 )
 
 // Parser represents the .env parser with quote context tracking
 type Parser struct {
 	tokenizer *Tokenizer
+	options   Options
+	warnings  []error
+
+	fsys     fs.FS    // filesystem included files are read from, nil for the OS
+	includes []string // files being parsed, outermost first
+
+	// earlier holds the values of files loaded before this one. They are
+	// seen by references and bare keys that the content does not define.
+	earlier map[string]string
 }
 
+// maxIncludeDepth limits how deeply include directives may nest
+const maxIncludeDepth = 16
+
 // NewParser creates a new parser for the given content
 func NewParser(content string) *Parser {
+	return NewParserWithOptions(content, Options{})
+}
+
+// NewParserWithOptions creates a new parser for the given content using the given options
+func NewParserWithOptions(content string, opts Options) *Parser {
+	opts = opts.withDialect()
 	return &Parser{
-		tokenizer: NewTokenizer(content),
+		tokenizer: NewTokenizerWithOptions(content, opts),
+		options:   opts,
+	}
+}
+
+// EntryKind tells how an entry was written
+type EntryKind int
+
+const (
+	// EntryAssignment is a KEY=value definition
+	EntryAssignment EntryKind = iota
+	// EntryPassthrough is a bare "export KEY", taking the value of KEY
+	// from the process environment if it is set there
+	EntryPassthrough
+	// EntryDeclaration is a bare "KEY", declaring a variable whose value
+	// must come from the process environment
+	EntryDeclaration
+)
+
+// String returns a string representation of the entry kind
+func (k EntryKind) String() string {
+	switch k {
+	case EntryAssignment:
+		return "assignment"
+	case EntryPassthrough:
+		return "passthrough"
+	case EntryDeclaration:
+		return "declaration"
+	default:
+		return "unknown"
 	}
 }
 
+// Entry is a single KEY=value definition from .env content
+type Entry struct {
+	Key      string
+	Value    string     // value with escapes resolved and variables expanded
+	RawValue string     // value with escapes resolved, before variable expansion
+	Quote    QuoteStyle // how the value was quoted
+	Line     int        // line of the key
+	Exported bool       // whether the definition had an "export" prefix
+	Kind     EntryKind  // assignment, or a bare key taken from the environment
+	File     string     // file of the definition, or Options.Filename
+}
+
 // ParseState represents the current parsing state
 type ParseState int
 
@@ -31,123 +97,479 @@ type LineResult struct {
 	Key            string
 	Value          string
 	AllowExpansion bool
+	Quote          QuoteStyle
+	Exported       bool
+	Kind           EntryKind
+	Line           int
 	Error          error
+
+	literals []int // offsets of escaped dollar signs in Value
+	pos      int   // byte offset of the key
+	col      int   // column of the key
+	valuePos int   // byte offset of the value
+	valueCol int   // column of the value
+
+	filename     string        // file the line was read from
+	content      string        // content of that file
+	include      string        // path named by an include directive
+	includeChain []IncludeStep // include directives leading to the file, innermost first
 }
 
-// ParseLine parses a single line and returns key, value, expansion flag, and any error
+// ParseLine parses a single line and returns key, value, expansion flag, and any error.
+// A key without '=' is reported with Kind EntryPassthrough or EntryDeclaration
+// and an empty value.
 func (p *Parser) ParseLine() LineResult {
-	// Skip leading whitespace
-	p.tokenizer.skipWhitespace()
+	result := LineResult{filename: p.options.Filename, content: p.tokenizer.content}
+	assigned := false
 
-	// Check for empty line or comment
-	if p.tokenizer.pos >= p.tokenizer.length ||
-		p.tokenizer.peek() == '\n' ||
-		p.tokenizer.peek() == '\r' ||
-		p.tokenizer.peek() == '#' {
-		p.tokenizer.skipToNextLine()
-		return LineResult{Key: "", Value: "", AllowExpansion: false, Error: nil}
+	for {
+		tok, err := p.tokenizer.Next()
+		if err != nil {
+			return p.fail(err, result.Key)
+		}
+
+		switch tok.Type {
+		case TokenExport:
+			result.Exported = true
+
+		case TokenKey:
+			result.Key = tok.Value
+			result.Line = tok.Line
+			result.pos, result.col = tok.Pos, tok.Col
+
+		case TokenAssign:
+			assigned = true
+
+		case TokenInclude:
+			result.include = tok.Value
+			result.Line = tok.Line
+			result.pos, result.col = tok.Pos, tok.Col
+
+		case TokenValue:
+			// Single-quoted values and quoted heredocs are never expanded
+			result.Value = tok.Value
+			result.AllowExpansion = tok.Quote != QuoteSingle && !tok.verbatim
+			result.Quote = tok.Quote
+			result.literals = tok.literals
+			result.valuePos, result.valueCol = tok.Pos, tok.Col
+
+		case TokenNewline, TokenEOF:
+			if result.Key != "" && !assigned {
+				result.Kind = EntryDeclaration
+				if result.Exported {
+					result.Kind = EntryPassthrough
+				}
+			}
+			return result
+		}
 	}
+}
 
-	// Handle optional "export " prefix
-	if p.tokenizer.exportMode && strings.HasPrefix(p.tokenizer.content[p.tokenizer.pos:], "export ") {
-		p.tokenizer.pos += 7 // skip "export "
-		p.tokenizer.col += 7
-		p.tokenizer.skipWhitespace()
+// fail returns a LineResult for err, annotating parse errors with the key and filename
+func (p *Parser) fail(err error, key string) LineResult {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.Filename = p.options.Filename
+		parseErr.Key = key
 	}
+	return LineResult{Key: "", Value: "", AllowExpansion: false, Error: err}
+}
 
-	// Parse key
-	key, err := p.tokenizer.parseKey()
-	if err != nil {
-		return LineResult{Key: "", Value: "", AllowExpansion: false, Error: err}
+// ParseLineCompat provides backward compatibility with the old ParseLine signature
+func (p *Parser) ParseLineCompat() (string, string, error) {
+	result := p.ParseLine()
+	return result.Key, result.Value, result.Error
+}
+
+// Parse parses the entire .env content and returns a map of environment
+// variables, or the first error in the content
+func (p *Parser) Parse() (map[string]string, error) {
+	_, env, errs := p.parse()
+	if len(errs) > 0 {
+		return nil, firstError(errs)
 	}
-	if key == "" {
-		return LineResult{Key: "", Value: "", AllowExpansion: false,
-			Error: fmt.Errorf("expected variable name at line %d", p.tokenizer.line)}
+	return env, nil
+}
+
+// ParseEntries parses the entire .env content and returns every definition
+// in the order it appears, including keys that are defined more than once
+func (p *Parser) ParseEntries() ([]Entry, error) {
+	entries, _, errs := p.parse()
+	if len(errs) > 0 {
+		return nil, firstError(errs)
 	}
+	return entries, nil
+}
 
-	// Skip whitespace after key
-	p.tokenizer.skipWhitespace()
+// Warnings returns the non-fatal problems found by the last parse, such as
+// keys defined more than once. Each warning is a *ParseError.
+func (p *Parser) Warnings() []error {
+	return p.warnings
+}
 
-	// Expect '=' assignment
-	if p.tokenizer.peek() != '=' {
-		return LineResult{Key: "", Value: "", AllowExpansion: false,
-			Error: fmt.Errorf("expected '=' after variable name at line %d", p.tokenizer.line)}
+// ParseAll parses the entire .env content like Parse, but instead of stopping
+// at the first bad line it skips to the next line and keeps going. It returns
+// every valid entry together with an error joining every problem found in
+// the order it appears (see errors.Join), or a nil error if the content is
+// valid.
+func (p *Parser) ParseAll() (map[string]string, error) {
+	_, env, errs := p.parse()
+	return env, errors.Join(errs...)
+}
+
+// firstError returns the first of the sorted errs. Missing declarations are
+// reported together, so if the first error is one, all of them are joined.
+func firstError(errs []error) error {
+	if !errors.Is(errs[0], ErrMissingValue) {
+		return errs[0]
+	}
+	var missing []error
+	for _, err := range errs {
+		if errors.Is(err, ErrMissingValue) {
+			missing = append(missing, err)
+		}
 	}
-	p.tokenizer.advance() // consume '='
+	return errors.Join(missing...)
+}
+
+// sortErrors orders errs by where they occur, following include directives
+// into the files they name
+func sortErrors(errs []error) {
+	slices.SortStableFunc(errs, func(a, b error) int {
+		return slices.Compare(errorPosition(a), errorPosition(b))
+	})
+}
 
-	// Skip whitespace after '='
-	p.tokenizer.skipWhitespace()
+// errorPosition returns the line and column pairs leading to err, from the
+// outermost file inward. Include directives count as column 0 of their line.
+func errorPosition(err error) []int {
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		return nil
+	}
+	var pos []int
+	for i := len(parseErr.IncludeChain) - 1; i >= 0; i-- {
+		pos = append(pos, parseErr.IncludeChain[i].Line, 0)
+	}
+	return append(pos, parseErr.Line, parseErr.Col)
+}
 
-	// Parse value and track quote type for variable expansion
-	var value string
-	var allowExpansion bool = true // default to allowing expansion
+// collect parses every line of the content, returning the lines that
+// define a key. Include directives are replaced by the lines of the file
+// they name. Lines with errors are skipped.
+func (p *Parser) collect() ([]LineResult, []error) {
+	var results []LineResult
+	var errs []error
 
-	ch := p.tokenizer.peek()
-	if ch == '"' {
-		// Double-quoted string - allow expansion
-		value, err = p.tokenizer.parseQuotedValue('"')
-		if err != nil {
-			return LineResult{Key: "", Value: "", AllowExpansion: false, Error: err}
+	for p.tokenizer.pos < p.tokenizer.length {
+		// After an error the tokenizer resumes at the next line
+		result := p.ParseLine()
+		if result.Error != nil && p.options.Dialect == DialectSystemd &&
+			(errors.Is(result.Error, ErrInvalidKey) || errors.Is(result.Error, ErrMissingAssign)) {
+			// systemd skips lines that are not valid assignments
+			p.warnings = append(p.warnings, result.Error)
+			continue
 		}
-		allowExpansion = true
-	} else if ch == '\'' {
-		// Single-quoted string - no variable expansion
-		value, err = p.tokenizer.parseQuotedValue('\'')
-		if err != nil {
-			return LineResult{Key: "", Value: "", AllowExpansion: false, Error: err}
+		if result.Error != nil {
+			errs = append(errs, result.Error)
+			continue
 		}
-		allowExpansion = false
-	} else {
-		// Unquoted value - allow expansion
-		var hasComment bool
-		value, hasComment = p.tokenizer.parseUnquotedValue()
-		allowExpansion = true
 
-		// Skip trailing comment if present
-		if hasComment {
-			p.tokenizer.skipToNextLine()
+		if result.include != "" {
+			included, includeErrs := p.include(result)
+			errs = append(errs, includeErrs...)
+			results = append(results, included...)
+			continue
+		}
+
+		// Skip empty lines and comments
+		if result.Key != "" {
+			results = append(results, result)
+		}
+	}
+
+	return results, errs
+}
+
+// include parses the file named by an include directive and returns the
+// lines that define a key, marked with the directive as a step of their
+// include chain
+func (p *Parser) include(directive LineResult) ([]LineResult, []error) {
+	name := p.includePath(directive.include)
+
+	// Files in an fs.FS cannot include anything outside its root
+	if p.fsys != nil && (path.IsAbs(directive.include) || !fs.ValidPath(name)) {
+		return nil, []error{p.directiveError(directive, KindInclude,
+			fmt.Errorf("%w: %s is outside the filesystem root", ErrInclude, directive.include))}
+	}
+
+	// The files currently being parsed, outermost first
+	stack := p.includes
+	if stack == nil && p.options.Filename != "" {
+		top := filepath.Clean(p.options.Filename)
+		if p.fsys != nil {
+			top = path.Clean(p.options.Filename)
 		}
+		stack = []string{top}
 	}
 
-	// Skip any remaining whitespace and comments on the line
-	p.tokenizer.skipWhitespace()
-	if p.tokenizer.pos < p.tokenizer.length && p.tokenizer.peek() == '#' {
-		p.tokenizer.skipToNextLine()
+	var err error
+	switch {
+	case slices.Contains(stack, name):
+		err = p.directiveError(directive, KindIncludeCycle,
+			fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(append(stack, name), " -> ")))
+	case len(stack) > maxIncludeDepth:
+		err = p.directiveError(directive, KindIncludeDepth,
+			fmt.Errorf("%w of %d", ErrIncludeDepth, maxIncludeDepth))
+	}
+	if err != nil {
+		return nil, []error{err}
 	}
 
-	return LineResult{Key: key, Value: value, AllowExpansion: allowExpansion, Error: nil}
+	data, err := readFile(p.fsys, name)
+	if err != nil {
+		return nil, []error{p.directiveError(directive, KindInclude, fmt.Errorf("%w: %w", ErrInclude, err))}
+	}
+	content, err := decodeInput(data, name)
+	if err != nil {
+		return nil, []error{withIncludeStep(err, p.options.Filename, directive.Line)}
+	}
+
+	opts := p.options
+	opts.Filename = name
+	child := NewParserWithOptions(content, opts)
+	child.fsys = p.fsys
+	child.includes = append(slices.Clone(stack), name)
+
+	results, errs := child.collect()
+	p.warnings = append(p.warnings, child.warnings...)
+	for i := range results {
+		results[i].includeChain = append(results[i].includeChain, IncludeStep{Filename: p.options.Filename, Line: directive.Line})
+	}
+	for i, err := range errs {
+		errs[i] = withIncludeStep(err, p.options.Filename, directive.Line)
+	}
+	return results, errs
 }
 
-// ParseLineCompat provides backward compatibility with the old ParseLine signature
-func (p *Parser) ParseLineCompat() (string, string, error) {
-	result := p.ParseLine()
-	return result.Key, result.Value, result.Error
+// includePath resolves name against the directory of the file being
+// parsed. Paths in an fs.FS are slash-separated and relative to its root.
+func (p *Parser) includePath(name string) string {
+	if p.fsys != nil {
+		return path.Join(path.Dir(p.options.Filename), name)
+	}
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(filepath.Dir(p.options.Filename), name)
 }
 
-// Parse parses the entire .env content and returns a map of environment variables
-func (p *Parser) Parse() (map[string]string, error) {
-	env := make(map[string]string)
+// directiveError reports a problem with an include directive
+func (p *Parser) directiveError(directive LineResult, kind ErrorKind, err error) *ParseError {
+	return &ParseError{
+		Filename: p.options.Filename,
+		Line:     directive.Line,
+		Col:      directive.col,
+		Kind:     kind,
+		Source:   sourceLine(p.tokenizer.content, directive.pos),
+		Err:      err,
+	}
+}
 
-	for p.tokenizer.pos < p.tokenizer.length {
-		result := p.ParseLine()
-		if result.Error != nil {
-			return nil, result.Error
+// withIncludeStep adds the include directive at filename:line to the
+// include chain of a parse error
+func withIncludeStep(err error, filename string, line int) error {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.IncludeChain = append(parseErr.IncludeChain, IncludeStep{Filename: filename, Line: line})
+	}
+	return err
+}
+
+// parse parses all lines and expands their values, returning the entries in
+// file order, the resulting environment and every error found, sorted by
+// position. Entries with errors are left out.
+func (p *Parser) parse() ([]Entry, map[string]string, []error) {
+	var results []LineResult
+	index := make(map[string]int) // key -> index of its winning definition
+	p.warnings = nil
+
+	collected, errs := p.collect()
+
+	for _, result := range collected {
+		// Bare keys take their value from the environment
+		if result.Kind != EntryAssignment {
+			value, ok := p.lookupBare(result.Key)
+			if !ok {
+				// Compose treats a bare key like "export KEY"
+				if result.Kind == EntryDeclaration && p.options.Dialect != DialectCompose {
+					errs = append(errs, p.missingError(result))
+				}
+				continue
+			}
+			result.Value = value
 		}
 
-		// Skip empty lines and comments
-		if result.Key == "" {
+		if i, defined := index[result.Key]; defined {
+			err := p.duplicateError(result, results[i])
+			if p.options.Duplicates == DuplicateError {
+				errs = append(errs, err)
+				continue
+			}
+			p.warnings = append(p.warnings, err)
+		}
+
+		if _, defined := index[result.Key]; !defined || p.options.Duplicates == DuplicateLastWins {
+			index[result.Key] = len(results)
+		}
+		results = append(results, result)
+	}
+
+	// Expand values in file order, or in dependency order for deferred
+	// expansion so references may point forward
+	var order []int
+	if p.options.Expansion == ExpandDeferred {
+		var cycleErrs []error
+		order, cycleErrs = expansionOrder(results, index)
+		for _, err := range cycleErrs {
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				result := results[index[parseErr.Key]]
+				parseErr.Filename = result.filename
+				parseErr.Source = sourceLine(result.content, result.pos)
+				parseErr.IncludeChain = result.includeChain
+			}
+			errs = append(errs, err)
+		}
+	} else {
+		order = make([]int, len(results))
+		for i := range order {
+			order[i] = i
+		}
+	}
+
+	env := make(map[string]string)
+	values := make([]string, len(results))
+	expanded := make([]bool, len(results))
+	for _, i := range order {
+		value, err := p.expandValue(results[i], env)
+		if err != nil {
+			errs = append(errs, err)
 			continue
 		}
 
-		value := result.Value
+		// Later definitions only replace earlier ones when the last one wins
+		if p.options.Duplicates == DuplicateLastWins || index[results[i].Key] == i {
+			env[results[i].Key] = value
+		}
+		values[i], expanded[i] = value, true
+	}
 
-		// Expand variables only if expansion is allowed and value contains $
-		if result.AllowExpansion && strings.Contains(value, "$") {
-			value = expandVariables(value, env)
+	// With deferred expansion, superseded definitions are expanded against
+	// the final values without affecting them
+	if p.options.Expansion == ExpandDeferred {
+		scratch := maps.Clone(env)
+		for i, result := range results {
+			if index[result.Key] == i {
+				continue
+			}
+			value, err := p.expandValue(result, scratch)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			values[i], expanded[i] = value, true
 		}
+	}
 
-		env[result.Key] = value
+	entries := make([]Entry, 0, len(results))
+	for i, result := range results {
+		if !expanded[i] {
+			continue
+		}
+		entries = append(entries, Entry{
+			Key:      result.Key,
+			Value:    values[i],
+			RawValue: result.Value,
+			Quote:    result.Quote,
+			Line:     result.Line,
+			Exported: result.Exported,
+			Kind:     result.Kind,
+			File:     result.filename,
+		})
 	}
 
-	return env, nil
+	sortErrors(errs)
+	return entries, env, errs
+}
+
+// duplicateError reports the redefinition of a key first defined by previous
+func (p *Parser) duplicateError(result, previous LineResult) *ParseError {
+	where := fmt.Sprintf("line %d", previous.Line)
+	if previous.filename != result.filename {
+		where = fmt.Sprintf("%s:%d", previous.filename, previous.Line)
+	}
+	return resultError(result, result.pos, result.col, KindDuplicateKey,
+		fmt.Errorf("%w: previously defined at %s", ErrDuplicateKey, where))
+}
+
+// resultError builds a ParseError for the problem at byte offset pos of the
+// file a parsed line came from
+func resultError(result LineResult, pos, col int, kind ErrorKind, err error) *ParseError {
+	return &ParseError{
+		Filename:     result.filename,
+		Line:         result.Line,
+		Col:          col,
+		Key:          result.Key,
+		Kind:         kind,
+		Source:       sourceLine(result.content, pos),
+		Err:          err,
+		IncludeChain: result.includeChain,
+	}
+}
+
+// lookupBare returns the value of a bare key from the files loaded before
+// this one, then from the lookup function, or from the process environment
+// when there is none
+func (p *Parser) lookupBare(key string) (string, bool) {
+	if value, exists := p.earlier[key]; exists {
+		return value, true
+	}
+	if p.options.Lookup != nil {
+		return p.options.Lookup(key)
+	}
+	return os.LookupEnv(key)
+}
+
+// missingError reports a declared key that is not set in the environment
+func (p *Parser) missingError(result LineResult) *ParseError {
+	return resultError(result, result.pos, result.col, KindMissingValue, ErrMissingValue)
+}
+
+// expandValue returns the value of a parsed line with variables expanded against env
+func (p *Parser) expandValue(result LineResult, env map[string]string) (string, error) {
+	// Expand variables only if expansion is allowed and value contains $
+	if !result.AllowExpansion || p.options.Expansion == ExpandNone || !strings.Contains(result.Value, "$") {
+		return result.Value, nil
+	}
+
+	opts := p.options
+	if p.earlier != nil {
+		lookup := opts.Lookup
+		opts.Lookup = func(key string) (string, bool) {
+			if value, exists := p.earlier[key]; exists {
+				return value, true
+			}
+			if lookup != nil {
+				return lookup(key)
+			}
+			return "", false
+		}
+	}
+
+	value, err := expandVariables(result.Value, result.literals, env, opts)
+	if err != nil {
+		return "", resultError(result, result.valuePos, result.valueCol, KindUnsetVariable, err)
+	}
+	return value, nil
 }
@@ -128,6 +128,14 @@ func MarshalToFileWithPrefix(filename string, v interface{}, prefix string) erro
 
 // WriteEnvFile writes a map of environment variables to a .env file
 func WriteEnvFile(filename string, env map[string]string) error {
+	return WriteEnvFileWithOptions(filename, env, Options{})
+}
+
+// WriteEnvFileWithOptions writes environment variables to a .env file,
+// quoting values so they read back the same in the dialect of opts.
+// With DialectSystemd the file is also read unchanged by this package's
+// default grammar, so it can be shared with systemd's EnvironmentFile=.
+func WriteEnvFileWithOptions(filename string, env map[string]string, opts Options) error {
 	var lines []string
 
 	// Sort keys for consistent output
@@ -149,8 +157,8 @@ func WriteEnvFile(filename string, env map[string]string) error {
 		value := env[key]
 
 		// Quote values that contain spaces or special characters
-		if needsQuoting(value) {
-			value = quoteValue(value)
+		if needsQuoting(value, opts) {
+			value = quoteValueFor(value, opts)
 		}
 
 		lines = append(lines, fmt.Sprintf("%s=%s", key, value))
@@ -164,17 +172,31 @@ func WriteEnvFile(filename string, env map[string]string) error {
 	return os.WriteFile(filename, []byte(content), 0644)
 }
 
-// needsQuoting determines if a value needs to be quoted
-func needsQuoting(value string) bool {
+// needsQuoting determines if a value needs to be quoted to read back
+// unchanged with the grammar in opts
+func needsQuoting(value string, opts Options) bool {
 	if value == "" {
 		return false
 	}
 
+	// A leading "<<" or backtick would open a heredoc or backtick value
+	if opts.Heredocs && strings.HasPrefix(value, "<<") || opts.Backticks && value[0] == '`' {
+		return true
+	}
+
+	// When '#' only starts a comment after whitespace, it needs no quotes
+	// of its own, since whitespace is quoted anyway
+	commentNeedsSpace := opts.withDialect().CommentNeedsSpace
+
 	// Quote if contains spaces, quotes, or special characters
 	for _, ch := range value {
 		switch ch {
-		case ' ', '\t', '\n', '\r', '"', '\'', '\\', '#', '$':
+		case ' ', '\t', '\n', '\r', '"', '\'', '\\', '$':
 			return true
+		case '#':
+			if !commentNeedsSpace {
+				return true
+			}
 		}
 	}
 
@@ -189,6 +211,26 @@ func quoteValue(value string) string {
 	escaped = strings.ReplaceAll(escaped, "\n", "\\n")  // Escape newlines
 	escaped = strings.ReplaceAll(escaped, "\t", "\\t")  // Escape tabs
 	escaped = strings.ReplaceAll(escaped, "\r", "\\r")  // Escape carriage returns
+	escaped = strings.ReplaceAll(escaped, "$", "\\$")   // Escape dollars to prevent expansion
+
+	return fmt.Sprintf("\"%s\"", escaped)
+}
+
+// quoteValueFor wraps a value in double quotes for the dialect of opts
+func quoteValueFor(value string, opts Options) string {
+	if opts.Dialect == DialectSystemd {
+		return quoteSystemdValue(value)
+	}
+	return quoteValue(value)
+}
+
+// quoteSystemdValue wraps a value in double quotes for systemd. systemd has
+// no escapes for control characters, so they are written as is; only the
+// characters both systemd and the default grammar unescape are escaped.
+func quoteSystemdValue(value string) string {
+	escaped := strings.ReplaceAll(value, "\\", "\\\\")
+	escaped = strings.ReplaceAll(escaped, "\"", "\\\"")
+	escaped = strings.ReplaceAll(escaped, "$", "\\$")
 
 	return fmt.Sprintf("\"%s\"", escaped)
 }
@@ -10,14 +10,34 @@ const (
 	TokenValue
 	TokenNewline
 	TokenEOF
+	TokenExport
+	TokenInclude
+)
+
+// QuoteStyle represents how a value was quoted in the source
+type QuoteStyle int
+
+const (
+	QuoteNone QuoteStyle = iota
+	QuoteSingle
+	QuoteDouble
+	QuoteBacktick
+	QuoteHeredoc
 )
 
 // Token represents a lexical token
 type Token struct {
 	Type  TokenType
-	Value string
+	Value string     // key name, comment text after '#', included path, or value with quotes and escapes resolved
+	Raw   string     // exact source text of the token
+	Quote QuoteStyle // quote style of a value token
+	Pos   int        // byte offset of the token in the content
 	Line  int
 	Col   int
+
+	literals  []int // offsets of escaped dollar signs in Value
+	verbatim  bool  // value is never expanded
+	markerLen int   // length of the "<<EOF" marker opening a heredoc value
 }
 
 // String returns a string representation of the token type
@@ -35,7 +55,29 @@ func (t TokenType) String() string {
 		return "NEWLINE"
 	case TokenEOF:
 		return "EOF"
+	case TokenExport:
+		return "EXPORT"
+	case TokenInclude:
+		return "INCLUDE"
 	default:
 		return "UNKNOWN"
 	}
 }
+
+// String returns a string representation of the quote style
+func (q QuoteStyle) String() string {
+	switch q {
+	case QuoteNone:
+		return "none"
+	case QuoteSingle:
+		return "single"
+	case QuoteDouble:
+		return "double"
+	case QuoteBacktick:
+		return "backtick"
+	case QuoteHeredoc:
+		return "heredoc"
+	default:
+		return "unknown"
+	}
+}
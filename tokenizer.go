@@ -2,8 +2,21 @@ package dotenv
 
 import (
 	"fmt"
-	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// lexState tracks where the tokenizer is within a line
+type lexState int
+
+const (
+	lexLineStart lexState = iota // at the start of a line
+	lexKey                       // after "export", expecting a key
+	lexAssign                    // after a key, expecting '='
+	lexValue                     // after '=', expecting a value
+	lexTrailing                  // after a value, expecting a comment or newline
 )
 
 // Tokenizer handles lexical analysis of .env content
@@ -14,17 +27,32 @@ type Tokenizer struct {
 	col        int
 	length     int
 	exportMode bool // whether to handle "export KEY=value" syntax
+	options    Options
+	state      lexState
+
+	// position of the last error, used to recover from it
+	errPos  int
+	errLine int
+	errCol  int
 }
 
 // NewTokenizer creates a new tokenizer for the given content
 func NewTokenizer(content string) *Tokenizer {
+	return NewTokenizerWithOptions(content, Options{})
+}
+
+// NewTokenizerWithOptions creates a new tokenizer for the given content
+// using the grammar settings in opts
+func NewTokenizerWithOptions(content string, opts Options) *Tokenizer {
+	opts = opts.withDialect()
 	return &Tokenizer{
 		content:    content,
 		pos:        0,
 		line:       1,
 		col:        1,
 		length:     len(content),
-		exportMode: true, // enable export handling by default
+		exportMode: !opts.DisableExport, // enable export handling by default
+		options:    opts,
 	}
 }
 
@@ -77,6 +105,18 @@ func (t *Tokenizer) skipToNextLine() {
 	}
 }
 
+// errorAt builds a ParseError for the problem at byte offset pos
+func (t *Tokenizer) errorAt(pos, line, col int, kind ErrorKind, err error) *ParseError {
+	t.errPos, t.errLine, t.errCol = pos, line, col
+	return &ParseError{
+		Line:   line,
+		Col:    col,
+		Kind:   kind,
+		Source: sourceLine(t.content, pos),
+		Err:    err,
+	}
+}
+
 // isValidKeyChar checks if character is valid in a key name
 func isValidKeyChar(ch byte) bool {
 	return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') ||
@@ -88,45 +128,111 @@ func isValidKeyStart(ch byte) bool {
 	return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || ch == '_'
 }
 
+// isKeyChar checks if character is valid in a key name, including the
+// extra characters allowed by the options
+func isKeyChar(ch byte, opts Options) bool {
+	return isValidKeyChar(ch) ||
+		(ch == '.' && opts.AllowDotsInKeys) ||
+		(ch == '-' && opts.AllowDashesInKeys)
+}
+
 // parseKey parses a key (identifier)
 func (t *Tokenizer) parseKey() (string, error) {
 	start := t.pos
 
 	// First character must be letter or underscore
 	if !isValidKeyStart(t.peek()) {
-		return "", fmt.Errorf("invalid key name at line %d: keys must start with letter or underscore", t.line)
+		return "", t.errorAt(t.pos, t.line, t.col, KindInvalidKey,
+			fmt.Errorf("%w: keys must start with letter or underscore", ErrInvalidKey))
 	}
 
-	for t.pos < t.length && isValidKeyChar(t.peek()) {
+	for t.pos < t.length && isKeyChar(t.peek(), t.options) {
 		t.advance()
 	}
 
 	return t.content[start:t.pos], nil
 }
 
-// parseUnquotedValue parses an unquoted value until comment or newline
-func (t *Tokenizer) parseUnquotedValue() (string, bool) {
+// parseUnquotedValue parses an unquoted value until comment or newline.
+// It also returns the offsets of escaped dollar signs in the value.
+func (t *Tokenizer) parseUnquotedValue() (string, []int) {
 	var result strings.Builder
-	hasComment := false
+	var literals []int
+	joined := false // a line continuation was just skipped
 
 	for t.pos < t.length {
 		ch := t.peek()
+		if t.atLineContinuation() {
+			joined = true
+			continue
+		}
 		if ch == '\n' || ch == '\r' {
 			break
 		}
-		if ch == '#' {
-			hasComment = true
+		if ch == '#' && t.options.CommentNeedsSpace && joined {
+			// The character before '#' is the last one of the joined value
+			value := result.String()
+			if value != "" && t.isSpace(value[len(value)-1]) {
+				break
+			}
+		} else if ch == '#' && (!t.options.CommentNeedsSpace || t.afterWhitespace()) {
 			break
 		}
+		joined = false
+		if ch == '\\' && t.peekNext() == '$' || t.atDollarEscape() {
+			// \$ (and $$ in Compose) is a literal dollar sign that is never expanded
+			t.advance()
+			literals = append(literals, result.Len())
+		}
 		result.WriteByte(t.advance())
 	}
 
 	// Only trim trailing whitespace, preserve leading whitespace
 	value := strings.TrimRight(result.String(), " \t")
-	return value, hasComment
-} // parseQuotedValue parses a quoted value (single or double quotes)
-func (t *Tokenizer) parseQuotedValue(quote byte) (string, error) {
+	return value, literals
+}
+
+// afterWhitespace reports whether the character before the current position
+// is a space or tab. Compose only recognizes a space.
+func (t *Tokenizer) afterWhitespace() bool {
+	return t.pos > 0 && t.isSpace(t.content[t.pos-1])
+}
+
+// isSpace reports whether ch is whitespace that lets '#' start an inline
+// comment. Compose only recognizes a space.
+func (t *Tokenizer) isSpace(ch byte) bool {
+	return ch == ' ' || (ch == '\t' && t.options.Dialect != DialectCompose)
+}
+
+// atLineContinuation skips a backslash at the end of a line together with
+// the line break when line continuation is enabled, and reports whether it did
+func (t *Tokenizer) atLineContinuation() bool {
+	if !t.options.LineContinuation || t.peek() != '\\' {
+		return false
+	}
+	next := t.peekNext()
+	if next == '\r' && t.pos+2 < t.length && t.content[t.pos+2] == '\n' {
+		t.advance()
+	} else if next != '\n' {
+		return false
+	}
+	t.advance()
+	t.advance()
+	return true
+}
+
+// atDollarEscape reports whether the current position holds the "$$"
+// escape of the Compose dialect
+func (t *Tokenizer) atDollarEscape() bool {
+	return t.options.Dialect == DialectCompose && t.peek() == '$' && t.peekNext() == '$'
+}
+
+// parseQuotedValue parses a quoted value (single or double quotes).
+// It also returns the offsets of escaped dollar signs in the value.
+func (t *Tokenizer) parseQuotedValue(quote byte) (string, []int, error) {
 	var result strings.Builder
+	var literals []int
+	startPos, startLine, startCol := t.pos, t.line, t.col
 	t.advance() // consume opening quote
 
 	for t.pos < t.length {
@@ -134,18 +240,63 @@ func (t *Tokenizer) parseQuotedValue(quote byte) (string, error) {
 
 		if ch == quote {
 			t.advance() // consume closing quote
-			return result.String(), nil
+			return result.String(), literals, nil
+		}
+
+		if quote == '\'' && ch == '\\' && t.peekNext() == '\'' && t.options.Dialect == DialectCompose {
+			// Compose keeps an escaped single quote as written
+			result.WriteByte(t.advance())
+			result.WriteByte(t.advance())
+			continue
+		}
+
+		if quote == '"' && t.atLineContinuation() {
+			continue
+		}
+
+		if quote == '"' && t.atDollarEscape() {
+			t.advance()
+			literals = append(literals, result.Len())
+			result.WriteByte(t.advance())
+			continue
 		}
 
 		if ch == '\\' && quote == '"' {
 			// Handle escapes only in double quotes
+			escPos, escLine, escCol := t.pos, t.line, t.col
 			t.advance() // consume backslash
 			if t.pos >= t.length {
-				return "", fmt.Errorf("unexpected end of file after escape at line %d", t.line)
+				return "", nil, t.errorAt(startPos, startLine, startCol, KindUnterminatedQuote,
+					fmt.Errorf("%w: unexpected end of file after escape", ErrUnterminatedQuote))
 			}
 
 			escaped := t.advance()
+			if t.options.Dialect == DialectCompose && strings.IndexByte("0exuU", escaped) >= 0 {
+				// Compose only unescapes single character escapes known to Go
+				result.WriteByte('\\')
+				result.WriteByte(escaped)
+				continue
+			}
+
 			switch escaped {
+			case 'x', 'u', 'U':
+				r, err := t.parseHexEscape(escaped, escPos, escLine, escCol)
+				if err != nil {
+					return "", nil, err
+				}
+				result.WriteRune(r)
+			case '0':
+				result.WriteByte(0)
+			case 'a':
+				result.WriteByte('\a')
+			case 'b':
+				result.WriteByte('\b')
+			case 'e':
+				result.WriteByte(0x1b)
+			case 'f':
+				result.WriteByte('\f')
+			case 'v':
+				result.WriteByte('\v')
 			case 'n':
 				result.WriteByte('\n')
 			case 't':
@@ -157,7 +308,15 @@ func (t *Tokenizer) parseQuotedValue(quote byte) (string, error) {
 			case '"':
 				result.WriteByte('"')
 			case '\'':
+				if t.options.Dialect == DialectCompose {
+					// Compose only unescapes what a Go string literal would
+					result.WriteByte('\\')
+				}
 				result.WriteByte('\'')
+			case '$':
+				// \$ is a literal dollar sign that is never expanded
+				literals = append(literals, result.Len())
+				result.WriteByte('$')
 			default:
 				// For unknown escapes, include both backslash and character
 				result.WriteByte('\\')
@@ -168,30 +327,485 @@ func (t *Tokenizer) parseQuotedValue(quote byte) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("unterminated quoted string at line %d", t.line)
+	return "", nil, t.errorAt(startPos, startLine, startCol, KindUnterminatedQuote, ErrUnterminatedQuote)
+}
+
+// parseHexEscape reads the hex digits of a \x, \u or \U escape whose
+// backslash is at pos and returns the value they encode. \u and \U must
+// encode a Unicode scalar value, so surrogate halves are rejected. \x is
+// limited to ASCII, since a lone byte above 0x7F is not valid UTF-8.
+func (t *Tokenizer) parseHexEscape(kind byte, pos, line, col int) (rune, error) {
+	digits := 2
+	switch kind {
+	case 'u':
+		digits = 4
+	case 'U':
+		digits = 8
+	}
+
+	end := min(t.pos+digits, t.length)
+	n, err := strconv.ParseUint(t.content[t.pos:end], 16, 32)
+	if err != nil || end-t.pos != digits {
+		return 0, t.errorAt(pos, line, col, KindInvalidEscape,
+			fmt.Errorf("%w: \\%c needs %d hex digits", ErrInvalidEscape, kind, digits))
+	}
+
+	r := rune(n)
+	if kind == 'x' && r > unicode.MaxASCII {
+		return 0, t.errorAt(pos, line, col, KindInvalidEscape,
+			fmt.Errorf("%w: \\x%s is not ASCII, use \\u00%s for the code point", ErrInvalidEscape,
+				t.content[t.pos:end], t.content[t.pos:end]))
+	}
+	if kind != 'x' && (utf16.IsSurrogate(r) || r > unicode.MaxRune) {
+		return 0, t.errorAt(pos, line, col, KindInvalidEscape,
+			fmt.Errorf("%w: \\%c%s is not a valid code point", ErrInvalidEscape, kind, t.content[t.pos:end]))
+	}
+
+	for t.pos < end {
+		t.advance()
+	}
+	return r, nil
 }
 
-// expandVariables expands ${VAR} and $VAR patterns in the value
-func expandVariables(value string, env map[string]string) string {
-	// First handle ${VAR} format
-	varPattern := regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
-	result := varPattern.ReplaceAllStringFunc(value, func(match string) string {
-		varName := match[2 : len(match)-1] // remove ${ and }
-		if val, exists := env[varName]; exists {
-			return val
+// parseHeredoc parses a heredoc value: "<<" or "<<-", a delimiter that ends
+// the line or is followed by a comment, and the lines up to one holding only
+// the delimiter. The value is those lines without the final line break. An
+// unquoted delimiter allows expansion, and "\$", "\\", "\`" and a backslash
+// before a line break are unescaped as in shells. A quoted delimiter keeps
+// the lines verbatim. It also returns the offset in the content where the
+// marker ends, just after the delimiter.
+func (t *Tokenizer) parseHeredoc() (string, []int, bool, int, error) {
+	startPos, startLine, startCol := t.pos, t.line, t.col
+	t.advance()
+	t.advance() // consume "<<"
+	stripTabs := t.peek() == '-'
+	if stripTabs {
+		t.advance()
+	}
+
+	// Read the delimiter, which may be quoted
+	verbatim := false
+	var delimiter string
+	if q := t.peek(); q == '\'' || q == '"' {
+		verbatim = true
+		t.advance()
+		end := strings.IndexByte(t.content[t.pos:], q)
+		if end < 0 || strings.ContainsAny(t.content[t.pos:t.pos+end], "\r\n") {
+			return "", nil, false, 0, t.errorAt(startPos, startLine, startCol, KindUnterminatedQuote,
+				fmt.Errorf("%w: heredoc delimiter", ErrUnterminatedQuote))
+		}
+		delimiter = t.content[t.pos : t.pos+end]
+		for i := 0; i <= end; i++ {
+			t.advance()
 		}
-		return match // keep original if not found
-	})
+	} else {
+		start := t.pos
+		for t.pos < t.length && isValidKeyChar(t.peek()) {
+			t.advance()
+		}
+		delimiter = t.content[start:t.pos]
+	}
+	if delimiter == "" {
+		return "", nil, false, 0, t.errorAt(startPos, startLine, startCol, KindUnterminatedQuote,
+			fmt.Errorf("%w: heredoc needs a delimiter", ErrUnterminatedQuote))
+	}
+	markerEnd := t.pos
 
-	// Then handle $VAR format (but not if already inside ${})
-	simplePattern := regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
-	result = simplePattern.ReplaceAllStringFunc(result, func(match string) string {
-		varName := match[1:] // remove $
-		if val, exists := env[varName]; exists {
-			return val
+	// The delimiter may only be followed by a comment, as in shells
+	t.skipWhitespace()
+	if t.peek() == '#' {
+		for t.pos < t.length && t.peek() != '\n' && t.peek() != '\r' {
+			t.advance()
 		}
-		return match // keep original if not found
-	})
+	}
+	if t.peek() != '\n' && t.peek() != '\r' {
+		if t.pos >= t.length {
+			return "", nil, false, 0, t.errorAt(startPos, startLine, startCol, KindUnterminatedQuote,
+				fmt.Errorf("%w: heredoc missing closing %s", ErrUnterminatedQuote, delimiter))
+		}
+		return "", nil, false, 0, t.errorAt(t.pos, t.line, t.col, KindTrailingText, ErrTrailingText)
+	}
+	t.skipToNextLine()
 
-	return result
+	var lines []string
+	for t.pos < t.length {
+		end := strings.IndexByte(t.content[t.pos:], '\n')
+		if end < 0 {
+			end = t.length - t.pos
+		}
+		line := strings.TrimSuffix(t.content[t.pos:t.pos+end], "\r")
+		if stripTabs {
+			line = strings.TrimLeft(line, "\t")
+		}
+
+		if line == delimiter {
+			// Leave the line break after the delimiter for the newline token
+			for t.pos < t.length && t.peek() != '\n' && t.peek() != '\r' {
+				t.advance()
+			}
+			body := strings.Join(lines, "\n")
+			if verbatim {
+				return body, nil, true, markerEnd, nil
+			}
+			value, literals := unescapeHeredoc(body)
+			return value, literals, false, markerEnd, nil
+		}
+
+		lines = append(lines, line)
+		t.skipToNextLine()
+	}
+
+	return "", nil, false, 0, t.errorAt(startPos, startLine, startCol, KindUnterminatedQuote,
+		fmt.Errorf("%w: heredoc missing closing %s", ErrUnterminatedQuote, delimiter))
+}
+
+// unescapeHeredoc resolves the escapes of an unquoted heredoc body. It also
+// returns the offsets of escaped dollar signs in the value.
+func unescapeHeredoc(body string) (string, []int) {
+	var result strings.Builder
+	var literals []int
+
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' || i+1 >= len(body) {
+			result.WriteByte(body[i])
+			continue
+		}
+		switch body[i+1] {
+		case '$':
+			literals = append(literals, result.Len())
+			result.WriteByte('$')
+		case '\\', '`':
+			result.WriteByte(body[i+1])
+		case '\n':
+			// Line continuation
+		default:
+			result.WriteByte('\\')
+			continue
+		}
+		i++
+	}
+
+	return result.String(), literals
+}
+
+// parseSystemdValue parses a value the way systemd reads an EnvironmentFile.
+// A value runs to the end of the line and may join several quoted and
+// unquoted parts. Outside quotes a backslash escapes the next character, or
+// continues the value on the next line; trailing unescaped whitespace is
+// dropped. Single quotes are literal. Inside double quotes a backslash only
+// escapes '"', '\\', '`', '$' and the line break. An unterminated quote runs
+// to the end of the content. The returned style is that of the first part.
+func (t *Tokenizer) parseSystemdValue() (string, QuoteStyle) {
+	var result strings.Builder
+	quote := QuoteNone
+	started := false
+	between := true // at the start or after a quoted part, where quotes open
+	end := 0        // length of the value without trailing whitespace
+
+	for t.pos < t.length {
+		ch := t.peek()
+		if ch == '\n' || ch == '\r' {
+			break
+		}
+
+		switch {
+		case between && (ch == ' ' || ch == '\t'):
+			t.advance()
+
+		case between && (ch == '\'' || ch == '"'):
+			if !started {
+				quote = QuoteSingle
+				if ch == '"' {
+					quote = QuoteDouble
+				}
+			}
+			t.parseSystemdQuoted(&result)
+			end = result.Len()
+
+		case ch == '\\':
+			between = false
+			t.advance()
+			next := t.peek()
+			if next == '\n' || next == '\r' {
+				// Line continuation
+				t.advance()
+			} else if t.pos < t.length {
+				result.WriteByte(t.advance())
+				end = result.Len()
+			}
+
+		default:
+			between = false
+			result.WriteByte(t.advance())
+			if ch != ' ' && ch != '\t' {
+				end = result.Len()
+			}
+		}
+		started = true
+	}
+
+	return result.String()[:end], quote
+}
+
+// parseSystemdQuoted parses a quoted part of a systemd value into result
+func (t *Tokenizer) parseSystemdQuoted(result *strings.Builder) {
+	quote := t.advance() // consume opening quote
+
+	for t.pos < t.length {
+		ch := t.advance()
+		switch {
+		case ch == quote:
+			return
+		case ch == '\\' && quote == '"' && t.pos < t.length:
+			escaped := t.advance()
+			switch escaped {
+			case '"', '\\', '`', '$':
+				result.WriteByte(escaped)
+			case '\n', '\r':
+				// Line continuation
+			default:
+				result.WriteByte('\\')
+				result.WriteByte(escaped)
+			}
+		default:
+			result.WriteByte(ch)
+		}
+	}
+}
+
+// Next returns the next token in the content. Whitespace between tokens is
+// not reported as a token; it lies between the Pos and Raw of consecutive
+// tokens. After an error the tokenizer skips to the start of the line after
+// the error, so tokenizing can continue.
+func (t *Tokenizer) Next() (Token, error) {
+	tok, err := t.next()
+	if err != nil {
+		// Resume at the line after the error, which may be past the start
+		// of a value spanning several lines
+		t.pos, t.line, t.col = t.errPos, t.errLine, t.errCol
+		t.skipToNextLine()
+		t.state = lexLineStart
+		return Token{}, err
+	}
+	return tok, nil
+}
+
+// next scans the next token according to the current state
+func (t *Tokenizer) next() (Token, error) {
+	spacePos, spaceLine, spaceCol := t.pos, t.line, t.col
+	t.skipWhitespace()
+	pos, line, col := t.pos, t.line, t.col
+
+	// Strict assignments allow no whitespace on either side of '='
+	if t.options.StrictAssign && pos > spacePos && (t.state == lexAssign || t.state == lexValue) {
+		return Token{}, t.errorAt(spacePos, spaceLine, spaceCol, KindInvalidWhitespace, ErrInvalidWhitespace)
+	}
+
+	switch t.state {
+	case lexKey:
+		return t.lexKey()
+
+	case lexAssign:
+		if t.peek() != '=' {
+			if t.atLineEnd() && t.options.Dialect != DialectSystemd {
+				// A key without a value, such as "export PATH" or "DEBUG"
+				t.state = lexTrailing
+				return t.next()
+			}
+			return Token{}, t.errorAt(pos, line, col, KindMissingAssign, ErrMissingAssign)
+		}
+		t.advance()
+		t.state = lexValue
+		return t.token(TokenAssign, pos, line, col, "="), nil
+
+	case lexValue:
+		return t.lexValue()
+	}
+
+	// At the start of a line or after a value
+	ch := t.peek()
+	switch {
+	case t.pos >= t.length:
+		return t.token(TokenEOF, pos, line, col, ""), nil
+
+	case ch == '\n' || ch == '\r':
+		if ch == '\r' && t.peekNext() == '\n' {
+			t.advance()
+		}
+		t.advance()
+		t.state = lexLineStart
+		return t.token(TokenNewline, pos, line, col, t.content[pos:t.pos]), nil
+
+	case t.options.Includes && t.state == lexLineStart && t.atInclude():
+		return t.lexInclude()
+
+	case ch == '#' || (ch == ';' && t.options.Dialect == DialectSystemd && t.state == lexLineStart):
+		for t.pos < t.length && t.peek() != '\n' && t.peek() != '\r' {
+			if t.peek() == '\\' && t.options.Dialect == DialectSystemd {
+				// systemd continues a comment after a backslash
+				t.advance()
+			}
+			t.advance()
+		}
+		return t.token(TokenComment, pos, line, col, t.content[pos+1:t.pos]), nil
+
+	case t.state == lexTrailing:
+		return Token{}, t.errorAt(pos, line, col, KindTrailingText, ErrTrailingText)
+
+	case t.exportMode && t.atExport():
+		for i := 0; i < len("export"); i++ {
+			t.advance()
+		}
+		t.state = lexKey
+		return t.token(TokenExport, pos, line, col, "export"), nil
+	}
+
+	return t.lexKey()
+}
+
+// atLineEnd reports whether the current position is at the end of a line,
+// the end of the content or the start of a comment
+func (t *Tokenizer) atLineEnd() bool {
+	ch := t.peek()
+	return t.pos >= t.length || ch == '\n' || ch == '\r' || ch == '#'
+}
+
+// atInclude reports whether the content at the current position starts
+// with an include directive: "# @include" or "source" followed by
+// whitespace, where "source" is not a key being assigned
+func (t *Tokenizer) atInclude() bool {
+	rest := t.content[t.pos:]
+	if strings.HasPrefix(rest, "#") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+		return strings.HasPrefix(rest, "@include ") || strings.HasPrefix(rest, "@include\t")
+	}
+	if !strings.HasPrefix(rest, "source ") && !strings.HasPrefix(rest, "source\t") {
+		return false
+	}
+	rest = strings.TrimLeft(rest[len("source"):], " \t")
+	return rest != "" && rest[0] != '=' && rest[0] != '\n' && rest[0] != '\r' && rest[0] != '#'
+}
+
+// lexInclude scans an include directive. Its value is the path, which may
+// be quoted.
+func (t *Tokenizer) lexInclude() (Token, error) {
+	pos, line, col := t.pos, t.line, t.col
+	keyword := "source"
+	if t.peek() == '#' {
+		t.advance()
+		t.skipWhitespace()
+		keyword = "@include"
+	}
+	for i := 0; i < len(keyword); i++ {
+		t.advance()
+	}
+	t.skipWhitespace()
+
+	var path string
+	switch q := t.peek(); q {
+	case '"', '\'':
+		end := strings.IndexByte(t.content[t.pos+1:], q)
+		if end < 0 || strings.ContainsAny(t.content[t.pos+1:t.pos+1+end], "\r\n") {
+			return Token{}, t.errorAt(t.pos, t.line, t.col, KindUnterminatedQuote, ErrUnterminatedQuote)
+		}
+		path = t.content[t.pos+1 : t.pos+1+end]
+		for i := 0; i < end+2; i++ {
+			t.advance()
+		}
+	default:
+		start := t.pos
+		for t.pos < t.length && !strings.ContainsRune(" \t\r\n", rune(t.peek())) {
+			t.advance()
+		}
+		path = t.content[start:t.pos]
+	}
+	if path == "" {
+		return Token{}, t.errorAt(pos, line, col, KindInclude,
+			fmt.Errorf("%w: missing path", ErrInclude))
+	}
+
+	t.state = lexTrailing
+	return t.token(TokenInclude, pos, line, col, path), nil
+}
+
+// atExport reports whether the content at the current position starts with
+// the "export" keyword followed by whitespace
+func (t *Tokenizer) atExport() bool {
+	rest := t.content[t.pos:]
+	return strings.HasPrefix(rest, "export ") || strings.HasPrefix(rest, "export\t")
+}
+
+// lexKey scans a key token
+func (t *Tokenizer) lexKey() (Token, error) {
+	pos, line, col := t.pos, t.line, t.col
+	key, err := t.parseKey()
+	if err != nil {
+		return Token{}, err
+	}
+	t.state = lexAssign
+	return t.token(TokenKey, pos, line, col, key), nil
+}
+
+// lexValue scans a quoted or unquoted value token
+func (t *Tokenizer) lexValue() (Token, error) {
+	pos, line, col := t.pos, t.line, t.col
+
+	var value string
+	var literals []int
+	var err error
+	quote := QuoteNone
+
+	verbatim := false
+	markerEnd := 0
+
+	switch {
+	case t.options.Dialect == DialectSystemd:
+		value, quote = t.parseSystemdValue()
+	case t.options.Heredocs && strings.HasPrefix(t.content[t.pos:], "<<"):
+		quote = QuoteHeredoc
+		value, literals, verbatim, markerEnd, err = t.parseHeredoc()
+	case t.options.Backticks && t.peek() == '`':
+		quote = QuoteBacktick
+		value, _, err = t.parseQuotedValue('`')
+	case t.peek() == '"':
+		quote = QuoteDouble
+		value, literals, err = t.parseQuotedValue('"')
+	case t.peek() == '\'':
+		quote = QuoteSingle
+		value, _, err = t.parseQuotedValue('\'')
+	default:
+		value, literals = t.parseUnquotedValue()
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	if limit := t.options.MaxValueLength; limit > 0 && len(value) > limit {
+		return Token{}, t.errorAt(pos, line, col, KindValueTooLong,
+			fmt.Errorf("%w of %d bytes", ErrValueTooLong, limit))
+	}
+
+	t.state = lexTrailing
+	tok := t.token(TokenValue, pos, line, col, value)
+	if quote == QuoteNone {
+		tok.Raw = strings.TrimRight(tok.Raw, " \t")
+	}
+	tok.Quote = quote
+	tok.literals = literals
+	tok.verbatim = verbatim
+	if quote == QuoteHeredoc {
+		tok.markerLen = markerEnd - pos
+	}
+	return tok, nil
+}
+
+// token builds a token that started at pos and ends at the current position
+func (t *Tokenizer) token(typ TokenType, pos, line, col int, value string) Token {
+	return Token{
+		Type:  typ,
+		Value: value,
+		Raw:   t.content[pos:t.pos],
+		Pos:   pos,
+		Line:  line,
+		Col:   col,
+	}
 }